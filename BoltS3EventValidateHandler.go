@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"gitlab.com/projectn-oss/projectn-bolt-go-sample/bolts3opsclient"
+)
+
+// HandleS3EventValidationRequest is the handler function that is invoked by AWS Lambda to process an S3 event
+// notification of a source bucket, for performing data validation tests of newly created objects.
+// For each ObjectCreated record, HandleS3EventValidationRequest retrieves the object from Bolt and S3, computes
+// their corresponding MD5 hash (if the object is gzip encoded, object is decompressed before computing its MD5)
+// and records the objects whose MD5 hashes do not match or that could not be retrieved. Mismatches are logged
+// and returned as part of the response, which has the following fields:
+// 1) matched - no. of objects whose Bolt and S3 MD5 hashes match
+// 2) mismatched, mismatches - no. and list of objects whose Bolt and S3 MD5 hashes do not match
+// 3) failed, failures - no. and list of objects that could not be retrieved from Bolt or S3
+// 4) skipped - no. of records that are not ObjectCreated events
+func HandleS3EventValidationRequest(ctx context.Context, event events.S3Event) (map[string]interface{}, error) {
+	return bolts3opsclient.ValidateS3Event(&event)
+}
+
+func main() {
+	lambda.Start(HandleS3EventValidationRequest)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"gitlab.com/projectn-oss/projectn-bolt-go-sample/bolts3http"
+)
+
+// HandleHTTPRequest is the handler function that is invoked by AWS Lambda to process an incoming API Gateway
+// (REST API or HTTP API) or Lambda Function URL request, so that the sample can be used as an HTTP gateway in
+// front of Bolt / S3.
+// HandleHTTPRequest maps the request onto an event as follows:
+// 1) path - /<bucket>/<key>
+// 2) query parameters - handler, sdkType, requestType, numKeys, objLength, bucketClean, stream, ...
+// 3) HTTP method - requestType, if not passed as a query parameter:
+//    GET (get_object, list_objects_v2, list_buckets), HEAD (head_object, head_bucket), PUT (put_object),
+//    DELETE (delete_object)
+// 4) body - object value of a PUT request, or the JSON event of a POST request.
+// Following are examples of requests that can be used to invoke the handler function.
+// a) Retrieve object (its MD5 Hash) from Bolt:
+//     GET /<bucket>/<key>?sdkType=bolt
+// b) Retrieve object data from Bolt:
+//     GET /<bucket>/<key>?sdkType=bolt&stream=true
+// c) Upload object to S3:
+//     PUT /<bucket>/<key>
+// d) Measure Get object performance of Bolt / S3:
+//     GET /<bucket>?handler=perf&requestType=get_object
+func HandleHTTPRequest(ctx context.Context, event json.RawMessage) (interface{}, error) {
+
+	// HTTP API and Function URL requests use payload format 2.0, REST API requests use payload format 1.0.
+	var version struct {
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(event, &version); err != nil {
+		return nil, err
+	}
+
+	if version.Version == "2.0" {
+		var req events.APIGatewayV2HTTPRequest
+		if err := json.Unmarshal(event, &req); err != nil {
+			return nil, err
+		}
+		return bolts3http.HandleAPIGatewayV2HTTPRequest(ctx, req), nil
+	}
+
+	var req events.APIGatewayProxyRequest
+	if err := json.Unmarshal(event, &req); err != nil {
+		return nil, err
+	}
+	return bolts3http.HandleAPIGatewayProxyRequest(ctx, req), nil
+}
+
+func main() {
+	lambda.Start(HandleHTTPRequest)
+}
@@ -17,11 +17,116 @@ import (
 	d) get_object_passthrough - get object (via passthrough) of unmonitored bucket
 	e) get_object_passthrough_ttfb - get object (first byte via passthrough) of unmonitored bucket
 	f) put_object - upload object
-	g) delete_object - delete object
+	g) delete_object - delete object (objects uploaded, unmeasured, before the test)
 	h) all - put, get, delete, list objects(default request if none specified)
+	i) mixed - mixed workload of get, put, head, list and delete objects, interleaved
+	j) get_object_range - get a byte range of object
+	k) head_object - get object metadata
+	l) copy_object - copy object (to a key under the run prefix, deleted with the other objects of the run)
+	m) put_object_multipart - upload object using a multipart upload
+	n) get_object_parallel - get object as parallel byte ranges
 
  2) bucket - bucket name
 
+ 3) numIter - no. of times each key is used by the test (default 1), or the no. of list requests of the
+    list objects test (default 10)
+
+ 4) duration - if passed (e.g. "60s"), each operation is run repeatedly over the keys until the duration has
+    elapsed, instead of numIter times.
+
+ 5) concurrency - no. of concurrent requests (default 1), or a comma-separated list of concurrency levels
+    (e.g. "1,8,32") to run the test at each level.
+
+ 6) mix - weights of the operations of the mixed workload (default "get=80,put=10,head=5,list=3,delete=2").
+    Perf stats are returned for each operation and for all operations.
+
+ 7) keyDistribution - distribution of the keys requested by the mixed workload: uniform (default), zipfian or
+    hotspot (80% of the operations request 20% of the keys).
+
+ 8) sizeDistribution - distribution of the sizes of uploaded objects, instead of objLength bytes:
+    fixed:<size>, uniform:<min>:<max>, lognormal:<median>:<sigma> or a list of sizes with weights
+    (e.g. "4KiB=50,1MiB=40,100MiB=10"). Perf stats include the throughput (MB/s) of each object size bucket.
+
+ 9) multipartThreshold - objects of at least this size are uploaded using multipart uploads (default 100MiB).
+
+ 10) payloadType - type of the data of uploaded objects: alphanumeric (default), random, compressible:<ratio>
+     (e.g. "compressible:4"), json or csv (synthetic log lines), or parquet (Parquet-like binary data).
+
+ 11) contentEncoding - if gzip, uploaded objects are gzip compressed and uploaded with 'Content-Encoding: gzip'.
+
+ 12) rate - if passed, requests are sent open-loop at the target rate (requests/s), and perf stats include the
+     latency measured from the scheduled start of each request (correctedLatency), which is corrected for
+     coordinated omission.
+
+ 13) outputFormat - text (default) to return the perf stats as formatted strings (e.g. "12 ms"), or numeric to
+     return them as numbers with their units, along with the parameters of the run. Runs that save or compare a
+     baseline return numeric perf stats by default.
+
+ 14) exportPath - if passed, the raw record of each request (operation, target, concurrency, key, size, start,
+     latency, time to first byte, status, retries, error and phases) is exported to a local path, or to
+     s3://<bucket>/<key> or bolt://<bucket>/<key>. A file name is generated if the path ends with '/'.
+
+ 15) exportFormat - format of the exported records: csv (default) or jsonl.
+
+ 16) keepObjects - objects created by put, delete, all and mixed tests are created under a unique run prefix
+     (bolt-s3-perf/<run id>/) and deleted once the run is complete, even if it failed or timed out, unless
+     keepObjects is true. The deleted objects are returned under cleanup.
+
+ 17) errorBudget - if passed, failed requests are counted by error code and HTTP status instead of failing the
+     test, until they exceed the budget: a no. of failed requests (e.g. "50") or a percentage of the requests
+     (e.g. "5%"). Perf stats include the error rate and breakdown (errors), and the stats of successful requests.
+
+ 18) numKeys - no. of keys used by the test (default 1000). Keys of get object tests are listed page by page.
+
+ 19) prefix - if passed, get object tests only use keys under the prefix.
+
+ 20) keySampling - first (default) to use the first numKeys keys, or random to sample numKeys keys uniformly among
+     all keys of the bucket (or manifest).
+
+ 21) manifest - if passed (s3://<bucket>/<key> or bolt://<bucket>/<key>), keys of get object tests are read from
+     the manifest, a text file with one key per line (optionally gzip compressed), instead of being listed.
+
+ 22) rangeSize - size of the byte ranges read by get_object_range (default 64KiB).
+
+ 23) rangeOffset - offset of the byte ranges in each object: start (default), end, random or sequential
+     (successive ranges, one per iteration).
+
+ 24) partSize - size of the parts of put_object_multipart and of the byte ranges of get_object_parallel
+     (default 5MiB). Perf stats include the latency of each part (partLatency) and the throughput of each
+     upload / download in MB/s (transferThroughput).
+
+ 25) partConcurrency - no. of parts of each object uploaded or downloaded in parallel (default 5).
+
+ 26) ordering - order of the requests against S3 and Bolt: sequential (default, all requests against S3, then
+     Bolt), alternating (each request against both, alternating which goes first) or random (each request against
+     both, in random order), so that caching and warm connections do not bias the comparison.
+
+ 27) warmup - no. of warmup requests sent to S3 and Bolt before the requests of each test (default 0), excluded
+     from the perf stats. Delete object tests are not warmed up.
+
+ 28) saveBaseline - if passed, the numeric perf stats of the run are saved as a baseline of that name, to detect
+     the regressions of later runs (e.g. after a Bolt upgrade). The location of the baseline is returned under
+     baseline.
+
+ 29) compareBaseline - if passed, the Bolt perf stats of the run are compared with those of the baseline of that
+     name, under baseline_comparison: the regressions (the metrics that changed by more than their threshold) and
+     a pass / fail verdict.
+
+ 30) baselinePath - location of the baselines: a local directory (default /tmp/bolt-s3-perf-baselines, which
+     only lasts as long as the Lambda execution environment), or s3://<bucket>/<prefix> or bolt://<bucket>/<prefix>.
+
+ 31) thresholds - largest change of each checked metric that is not a regression (default
+     "p50=10%,p99=20%,opsThroughput=10%,errorRate=1"): the increase of average, p50, p90, p95, p99 or p99.9
+     latency or the decrease of opsThroughput or bytesThroughput in %, or the increase of errorRate in percentage
+     points.
+
+ Perf stats include the latency of each phase of the requests (phases), traced with httptrace: dns, connect and
+ tls for requests that opened a new connection, write (request), firstByte (server time) and transfer (response).
+
+ The latency of Bolt is compared with that of S3 in each test (<test>_comparison): the ratio and difference of
+ each percentile, with bootstrap confidence intervals, the Mann-Whitney U test of the latencies, and a verdict
+ stating whether Bolt is faster, slower or not distinguishable from S3 in the run.
+
  Following are examples of events, for various requests, that can be used to invoke the handler function.
 	a) Measure List objects performance of Bolt/S3.
 		{"requestType": "list_objects_v2", "bucket": "<bucket>"}
@@ -46,10 +151,64 @@ import (
 
   	h) Measure Put, Delete, Get, List objects performance of Bolt / S3.
      	{"requestType": "all", "bucket": "<bucket>"}
+
+	i) Measure Get object performance of Bolt / S3 for 60 seconds each.
+		{"requestType": "get_object", "bucket": "<bucket>", "duration": "60s"}
+
+	j) Measure Get object performance of Bolt / S3 with 1, 8 and 32 concurrent requests.
+		{"requestType": "get_object", "bucket": "<bucket>", "concurrency": "1,8,32"}
+
+	k) Measure Put object performance of Bolt / S3 with small, medium and large objects.
+		{"requestType": "put_object", "bucket": "<bucket>", "numKeys": "20", "sizeDistribution": "4KiB=50,1MiB=40,200MiB=10"}
+
+	l) Measure performance of Bolt / S3 under a read-heavy mixed workload on 100 popular keys.
+		{"requestType": "mixed", "bucket": "<bucket>", "numKeys": "100", "mix": "get=90,put=5,head=5", "keyDistribution": "zipfian"}
+
+	m) Measure Put object performance of Bolt / S3 with gzip compressed JSON logs.
+		{"requestType": "put_object", "bucket": "<bucket>", "sizeDistribution": "fixed:1MiB", "payloadType": "json", "contentEncoding": "gzip"}
+
+	n) Measure Get object latency of Bolt / S3 at 200 requests/s for 60 seconds each, with up to 64 concurrent requests.
+		{"requestType": "get_object", "bucket": "<bucket>", "rate": "200", "duration": "60s", "concurrency": "64"}
+
+	o) Measure Get object performance of Bolt / S3, with the perf stats as numbers and the parameters of the run.
+		{"requestType": "get_object", "bucket": "<bucket>", "outputFormat": "numeric"}
+
+	p) Measure Get object performance of Bolt / S3, exporting the record of each request as JSON Lines to S3.
+		{"requestType": "get_object", "bucket": "<bucket>", "exportPath": "s3://<results-bucket>/perf/", "exportFormat": "jsonl"}
+
+	q) Measure Put object performance of Bolt / S3 at 64 concurrent requests, tolerating up to 5% of failed requests.
+		{"requestType": "put_object", "bucket": "<bucket>", "concurrency": "64", "errorBudget": "5%"}
+
+	r) Measure Get object performance of Bolt / S3 on 10000 keys sampled at random under a prefix.
+		{"requestType": "get_object", "bucket": "<bucket>", "numKeys": "10000", "prefix": "logs/", "keySampling": "random"}
+
+	s) Measure Get object performance of Bolt / S3 reading the last 8 KiB of each object.
+		{"requestType": "get_object_range", "bucket": "<bucket>", "rangeSize": "8KiB", "rangeOffset": "end"}
+
+	t) Measure Head object performance of Bolt / S3.
+		{"requestType": "head_object", "bucket": "<bucket>"}
+
+	u) Measure Copy object performance of Bolt / S3.
+		{"requestType": "copy_object", "bucket": "<bucket>", "numKeys": "100"}
+
+	v) Measure multipart upload performance of Bolt / S3 with 1 GiB objects, in 16 MiB parts, 10 at a time.
+		{"requestType": "put_object_multipart", "bucket": "<bucket>", "numKeys": "10", "sizeDistribution": "fixed:1GiB", "partSize": "16MiB", "partConcurrency": "10"}
+
+	w) Measure parallel download performance of Bolt / S3, in 8 MiB ranges, 10 at a time.
+		{"requestType": "get_object_parallel", "bucket": "<bucket>", "numKeys": "10", "partSize": "8MiB", "partConcurrency": "10"}
+
+	x) Measure Get object performance of Bolt / S3, sending each request to both in random order after 100 warmup requests.
+		{"requestType": "get_object", "bucket": "<bucket>", "ordering": "random", "warmup": "100"}
+
+	y) Measure Get object performance of Bolt / S3, saving the perf stats in S3 as the baseline of a Bolt release.
+		{"requestType": "get_object", "bucket": "<bucket>", "saveBaseline": "bolt-1.2", "baselinePath": "s3://<results-bucket>/baselines"}
+
+	z) Measure Get object performance of Bolt / S3, checking the perf stats of Bolt for regressions against a baseline.
+		{"requestType": "get_object", "bucket": "<bucket>", "compareBaseline": "bolt-1.2", "baselinePath": "s3://<results-bucket>/baselines", "thresholds": "p50=5%,p99=15%"}
  */
 func HandlePerfRequest(ctx context.Context, event bolts3perf.PerfEvent) (map[string]interface{}, error) {
 	boltS3Perf := bolts3perf.BoltS3Perf{}
-	return boltS3Perf.ProcessEvent(&event)
+	return boltS3Perf.ProcessEventWithContext(ctx, &event)
 }
 
 func main() {
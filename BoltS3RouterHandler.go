@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/aws/aws-lambda-go/lambda"
+	"gitlab.com/projectn-oss/projectn-bolt-go-sample/bolts3router"
+)
+
+// HandleRouterRequest is the handler function that is invoked by AWS Lambda to process an incoming event and
+// dispatch it to the Ops, Perf, Data Validation or Auto Heal logic, so that a single deployed function can
+// drive every test type from the event alone.
+// HandleRouterRequest accepts the following input parameters as part of the event:
+// 1) handler (or mode) - handler logic used to process the event. The following values are supported:
+//    a) ops - S3 API operations with Bolt and S3 (default handler if none specified)
+//    b) perf - Bolt / S3 Performance tests
+//    c) validate - Data validation tests
+//    d) autoheal - Auto heal tests
+// 2) input parameters of the selected handler (see BoltS3OpsHandler, BoltS3PerfHandler,
+//    BoltS3ValidateObjHandler and BoltAutoHealHandler)
+// Following are examples of events that can be used to invoke the handler function.
+// a) Upload object to Bolt:
+//     {"handler": "ops", "requestType": "put_object", "sdkType": "BOLT", "bucket": "<bucket>", "key": "<key>", "value": "<value>"}
+// b) Measure Get object performance of Bolt / S3:
+//     {"handler": "perf", "requestType": "get_object", "bucket": "<bucket>"}
+// c) Retrieve object(its MD5 hash) from Bolt and S3:
+//     {"handler": "validate", "bucket": "<bucket>", "key": "<key>"}
+// d) Measure Auto-Heal time of an object in Bolt:
+//     {"handler": "autoheal", "bucket": "<bucket>", "key": "<key>"}
+func HandleRouterRequest(ctx context.Context, event json.RawMessage) (map[string]interface{}, error) {
+	return bolts3router.Route(ctx, event)
+}
+
+func main() {
+	lambda.Start(HandleRouterRequest)
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"gitlab.com/projectn-oss/projectn-bolt-go-sample/bolts3sqs"
+)
+
+// HandleSQSRequest is the handler function that is invoked by AWS Lambda to process a batch of SQS messages.
+// The body of each message is an event, as accepted by BoltS3RouterHandler, whose 'handler' (or 'mode') field
+// selects the Ops, Perf, Data Validation or Auto Heal logic that processes it. Messages are processed with up to
+// 'SQS_CONCURRENCY' (default 10) messages in flight, and the messages that failed are reported as batch item
+// failures, so that only those messages are retried.
+// Following are examples of message bodies.
+// a) Retrieve object(its MD5 hash) from Bolt and S3:
+//     {"handler": "validate", "bucket": "<bucket>", "key": "<key>"}
+// b) Upload object to Bolt:
+//     {"handler": "ops", "requestType": "put_object", "sdkType": "BOLT", "bucket": "<bucket>", "key": "<key>", "value": "<value>"}
+func HandleSQSRequest(ctx context.Context, event events.SQSEvent) (bolts3sqs.SQSEventResponse, error) {
+	return bolts3sqs.ProcessEvent(ctx, &event), nil
+}
+
+func main() {
+	lambda.Start(HandleSQSRequest)
+}
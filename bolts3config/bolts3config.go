@@ -0,0 +1,261 @@
+package bolts3config
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"gitlab.com/projectn-oss/projectn-bolt-go/bolts3"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// ClientConfig holds the retry, backoff and timeout settings of the S3 and Bolt clients, as passed in the event.
+// Settings that are not passed in the event are read from the corresponding environment variable, and settings
+// that are configured in neither use the AWS SDK defaults. Delays and timeouts are durations (e.g. "500ms", "2s")
+// or a number of milliseconds.
+type ClientConfig struct {
+	MaxRetries string `json:"maxRetries"`
+	MinRetryDelay string `json:"minRetryDelay"`
+	MaxRetryDelay string `json:"maxRetryDelay"`
+	MinThrottleDelay string `json:"minThrottleDelay"`
+	MaxThrottleDelay string `json:"maxThrottleDelay"`
+	ConnectTimeout string `json:"connectTimeout"`
+	TLSHandshakeTimeout string `json:"tlsHandshakeTimeout"`
+	ResponseHeaderTimeout string `json:"responseHeaderTimeout"`
+	OperationTimeout string `json:"operationTimeout"`
+}
+
+// Policy is the parsed retry, backoff and timeout policy applied to the S3 and Bolt clients.
+// A zero value (or -1 for MaxRetries) means the AWS SDK default is used.
+type Policy struct {
+	MaxRetries int
+	MinRetryDelay time.Duration
+	MaxRetryDelay time.Duration
+	MinThrottleDelay time.Duration
+	MaxThrottleDelay time.Duration
+	ConnectTimeout time.Duration
+	TLSHandshakeTimeout time.Duration
+	ResponseHeaderTimeout time.Duration
+	OperationTimeout time.Duration
+	// MaxIdleConnsPerHost is the no. of idle connections kept open to each S3 / Bolt endpoint, which should be
+	// at least the no. of concurrent requests. It is not configurable via the event.
+	MaxIdleConnsPerHost int
+}
+
+// RetryStats counts the requests sent by a client and the retries they needed.
+type RetryStats struct {
+	Requests int64 `json:"requests"`
+	RetriedRequests int64 `json:"retriedRequests"`
+	Retries int64 `json:"retries"`
+	MaxRetries int64 `json:"maxRetries"`
+}
+
+// Clients holds S3 and Bolt clients configured with the same policy, along with their retry statistics.
+type Clients struct {
+	S3Svc *s3.S3
+	BoltSvc *s3.S3
+	S3RetryStats *RetryStats
+	BoltRetryStats *RetryStats
+}
+
+// NewClients creates S3 and Bolt clients that apply the retry, backoff and timeout policy of the config.
+func NewClients(c *ClientConfig) (*Clients, error) {
+
+	policy, err := c.Policy()
+	if err != nil {
+		return nil, err
+	}
+	return policy.NewClients()
+}
+
+// NewClients creates S3 and Bolt clients that apply the policy.
+func (p *Policy) NewClients() (*Clients, error) {
+
+	cfg := p.AWSConfig()
+	sess, err := session.NewSession(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	clients := &Clients{
+		S3Svc:          s3.New(sess),
+		BoltSvc:        bolts3.New(sess, cfg),
+		S3RetryStats:   &RetryStats{},
+		BoltRetryStats: &RetryStats{},
+	}
+	p.instrument(clients.S3Svc, clients.S3RetryStats)
+	p.instrument(clients.BoltSvc, clients.BoltRetryStats)
+	return clients, nil
+}
+
+// Policy parses the settings of the config, falling back to the environment variables MAX_RETRIES,
+// MIN_RETRY_DELAY, MAX_RETRY_DELAY, MIN_THROTTLE_DELAY, MAX_THROTTLE_DELAY, CONNECT_TIMEOUT,
+// TLS_HANDSHAKE_TIMEOUT, RESPONSE_HEADER_TIMEOUT and OPERATION_TIMEOUT.
+func (c *ClientConfig) Policy() (*Policy, error) {
+
+	policy := &Policy{MaxRetries: -1}
+
+	if v := setting(c.MaxRetries, "MAX_RETRIES"); len(v) > 0 {
+		maxRetries, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid maxRetries: %v", err)
+		}
+		policy.MaxRetries = maxRetries
+	}
+
+	durations := []struct {
+		name string
+		value string
+		env string
+		dst *time.Duration
+	}{
+		{"minRetryDelay", c.MinRetryDelay, "MIN_RETRY_DELAY", &policy.MinRetryDelay},
+		{"maxRetryDelay", c.MaxRetryDelay, "MAX_RETRY_DELAY", &policy.MaxRetryDelay},
+		{"minThrottleDelay", c.MinThrottleDelay, "MIN_THROTTLE_DELAY", &policy.MinThrottleDelay},
+		{"maxThrottleDelay", c.MaxThrottleDelay, "MAX_THROTTLE_DELAY", &policy.MaxThrottleDelay},
+		{"connectTimeout", c.ConnectTimeout, "CONNECT_TIMEOUT", &policy.ConnectTimeout},
+		{"tlsHandshakeTimeout", c.TLSHandshakeTimeout, "TLS_HANDSHAKE_TIMEOUT", &policy.TLSHandshakeTimeout},
+		{"responseHeaderTimeout", c.ResponseHeaderTimeout, "RESPONSE_HEADER_TIMEOUT", &policy.ResponseHeaderTimeout},
+		{"operationTimeout", c.OperationTimeout, "OPERATION_TIMEOUT", &policy.OperationTimeout},
+	}
+	for _, d := range durations {
+		if v := setting(d.value, d.env); len(v) > 0 {
+			duration, err := ParseDuration(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %v", d.name, err)
+			}
+			*d.dst = duration
+		}
+	}
+	return policy, nil
+}
+
+// AWSConfig returns the AWS config that applies the retryer and HTTP transport settings of the policy.
+func (p *Policy) AWSConfig() *aws.Config {
+
+	cfg := aws.NewConfig()
+
+	if p.MaxRetries >= 0 || p.MinRetryDelay > 0 || p.MaxRetryDelay > 0 ||
+		p.MinThrottleDelay > 0 || p.MaxThrottleDelay > 0 {
+		retryer := client.DefaultRetryer{
+			NumMaxRetries:    client.DefaultRetryerMaxNumRetries,
+			MinRetryDelay:    p.MinRetryDelay,
+			MaxRetryDelay:    p.MaxRetryDelay,
+			MinThrottleDelay: p.MinThrottleDelay,
+			MaxThrottleDelay: p.MaxThrottleDelay,
+		}
+		if p.MaxRetries >= 0 {
+			retryer.NumMaxRetries = p.MaxRetries
+		}
+		cfg.Retryer = retryer
+	}
+
+	if p.ConnectTimeout > 0 || p.TLSHandshakeTimeout > 0 || p.ResponseHeaderTimeout > 0 || p.MaxIdleConnsPerHost > 0 {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		if p.ConnectTimeout > 0 {
+			dialer := &net.Dialer{Timeout: p.ConnectTimeout, KeepAlive: 30 * time.Second}
+			transport.DialContext = dialer.DialContext
+		}
+		if p.TLSHandshakeTimeout > 0 {
+			transport.TLSHandshakeTimeout = p.TLSHandshakeTimeout
+		}
+		if p.ResponseHeaderTimeout > 0 {
+			transport.ResponseHeaderTimeout = p.ResponseHeaderTimeout
+		}
+		if p.MaxIdleConnsPerHost > 0 {
+			transport.MaxIdleConnsPerHost = p.MaxIdleConnsPerHost
+			if transport.MaxIdleConns < 2*p.MaxIdleConnsPerHost {
+				transport.MaxIdleConns = 2 * p.MaxIdleConnsPerHost
+			}
+		}
+		cfg.HTTPClient = &http.Client{Transport: transport}
+	}
+	return cfg
+}
+
+// instrument adds handlers to the client that bound each operation, including its retries and the reading of a
+// GetObject response body, by the operation timeout and that record the no. of retries of each request.
+func (p *Policy) instrument(svc *s3.S3, stats *RetryStats) {
+
+	if p.OperationTimeout > 0 {
+		timeout := p.OperationTimeout
+		svc.Handlers.Validate.PushFront(func(r *request.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			r.SetContext(ctx)
+			r.Handlers.Complete.PushBack(func(r *request.Request) {
+				// Keep the operation context alive until the object data has been read.
+				if output, ok := r.Data.(*s3.GetObjectOutput); ok && r.Error == nil && output.Body != nil {
+					output.Body = &cancelOnClose{ReadCloser: output.Body, cancel: cancel}
+					return
+				}
+				cancel()
+			})
+		})
+	}
+
+	svc.Handlers.Complete.PushBack(func(r *request.Request) {
+		stats.record(int64(r.RetryCount))
+	})
+}
+
+// record adds a request, and the no. of retries it needed, to the statistics.
+func (s *RetryStats) record(retries int64) {
+	atomic.AddInt64(&s.Requests, 1)
+	if retries == 0 {
+		return
+	}
+	atomic.AddInt64(&s.RetriedRequests, 1)
+	atomic.AddInt64(&s.Retries, retries)
+	for {
+		maxRetries := atomic.LoadInt64(&s.MaxRetries)
+		if retries <= maxRetries || atomic.CompareAndSwapInt64(&s.MaxRetries, maxRetries, retries) {
+			return
+		}
+	}
+}
+
+// Snapshot returns a copy of the statistics that is safe to read while requests are in flight.
+func (s *RetryStats) Snapshot() RetryStats {
+	return RetryStats{
+		Requests:        atomic.LoadInt64(&s.Requests),
+		RetriedRequests: atomic.LoadInt64(&s.RetriedRequests),
+		Retries:         atomic.LoadInt64(&s.Retries),
+		MaxRetries:      atomic.LoadInt64(&s.MaxRetries),
+	}
+}
+
+// ParseDuration parses a duration string (e.g. "500ms", "2s") or a number of milliseconds.
+func ParseDuration(s string) (time.Duration, error) {
+	if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Duration(ms) * time.Millisecond, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// setting returns the value passed in the event, or the value of the environment variable if none was passed.
+func setting(value string, env string) string {
+	if len(value) > 0 {
+		return value
+	}
+	return os.Getenv(env)
+}
+
+// cancelOnClose cancels the operation context once the response body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
@@ -0,0 +1,324 @@
+package bolts3http
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"gitlab.com/projectn-oss/projectn-bolt-go-sample/bolts3opsclient"
+	"gitlab.com/projectn-oss/projectn-bolt-go-sample/bolts3router"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// maxStreamedObjectSize is the largest object that is streamed back in a response. Lambda limits the
+// response payload to 6 MB, and the object data is base64 encoded.
+const maxStreamedObjectSize = 4 * 1024 * 1024
+
+// HTTPRequest holds the parts of an API Gateway / Lambda Function URL request that are mapped onto an event.
+type HTTPRequest struct {
+	Method string
+	Path string
+	// whether the path is percent-encoded (raw path of payload format 2.0 requests).
+	PathEncoded bool
+	PathParameters map[string]string
+	QueryStringParameters map[string]string
+	Body string
+	IsBase64Encoded bool
+}
+
+// HTTPResponse holds the status code, headers and body returned for an HTTP request.
+type HTTPResponse struct {
+	StatusCode int
+	Headers map[string]string
+	Body string
+	IsBase64Encoded bool
+}
+
+// HandleAPIGatewayProxyRequest processes an API Gateway REST API (payload format 1.0) request.
+func HandleAPIGatewayProxyRequest(ctx context.Context,
+	req events.APIGatewayProxyRequest) events.APIGatewayProxyResponse {
+	resp := ProcessRequest(ctx, &HTTPRequest{
+		Method:                req.HTTPMethod,
+		Path:                  req.Path,
+		PathParameters:        req.PathParameters,
+		QueryStringParameters: req.QueryStringParameters,
+		Body:                  req.Body,
+		IsBase64Encoded:       req.IsBase64Encoded,
+	})
+
+	return events.APIGatewayProxyResponse{
+		StatusCode:      resp.StatusCode,
+		Headers:         resp.Headers,
+		Body:            resp.Body,
+		IsBase64Encoded: resp.IsBase64Encoded,
+	}
+}
+
+// HandleAPIGatewayV2HTTPRequest processes an API Gateway HTTP API (payload format 2.0) request.
+// Lambda Function URL requests use the same payload format and are processed by this function as well.
+func HandleAPIGatewayV2HTTPRequest(ctx context.Context,
+	req events.APIGatewayV2HTTPRequest) events.APIGatewayV2HTTPResponse {
+	resp := ProcessRequest(ctx, &HTTPRequest{
+		Method:                req.RequestContext.HTTP.Method,
+		Path:                  req.RawPath,
+		PathEncoded:           true,
+		PathParameters:        req.PathParameters,
+		QueryStringParameters: req.QueryStringParameters,
+		Body:                  req.Body,
+		IsBase64Encoded:       req.IsBase64Encoded,
+	})
+
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode:      resp.StatusCode,
+		Headers:         resp.Headers,
+		Body:            resp.Body,
+		IsBase64Encoded: resp.IsBase64Encoded,
+	}
+}
+
+// ProcessRequest maps the path, query parameters and body of the HTTP request onto an event, dispatches
+// the event to the selected handler logic and returns the result with an appropriate HTTP status code.
+//
+// The path is interpreted as /<bucket>/<key> (percent-decoded if the path is encoded), unless 'bucket' and 'key'
+// (or 'proxy') path parameters are defined on the route. Query parameters (handler, sdkType, requestType, numKeys, objLength, ...) are passed
+// through as event fields, and a JSON body of a POST request is used as the event itself. If requestType is
+// not passed, it is derived from the HTTP method:
+// 1) GET - get_object if a key is passed, list_objects_v2 if only a bucket is passed, list_buckets otherwise
+// 2) HEAD - head_object if a key is passed, head_bucket otherwise
+// 3) PUT - put_object with the request body as value
+// 4) DELETE - delete_object
+// If 'stream' is 'true' on a get_object request, the object data is returned as the response body instead of
+// its MD5 hash. ctx is the Lambda context of the request.
+func ProcessRequest(ctx context.Context, req *HTTPRequest) *HTTPResponse {
+
+	body := req.Body
+	if req.IsBase64Encoded {
+		data, err := base64.StdEncoding.DecodeString(req.Body)
+		if err != nil {
+			return errorResponse(http.StatusBadRequest, "InvalidRequest", err.Error())
+		}
+		body = string(data)
+	}
+
+	method := strings.ToUpper(req.Method)
+	event := make(map[string]interface{})
+
+	// A POST request carries the event in its body.
+	if method == http.MethodPost && len(body) > 0 {
+		if err := json.Unmarshal([]byte(body), &event); err != nil {
+			return errorResponse(http.StatusBadRequest, "InvalidRequest", err.Error())
+		}
+	}
+
+	bucket, key, err := requestPath(req)
+	if err != nil {
+		return errorResponse(http.StatusBadRequest, "InvalidRequest", err.Error())
+	}
+	if len(bucket) > 0 {
+		event["bucket"] = bucket
+	}
+	if len(key) > 0 {
+		event["key"] = key
+	}
+
+	for name, value := range req.QueryStringParameters {
+		event[name] = value
+	}
+
+	if _, ok := event["requestType"]; !ok {
+		if requestType := defaultRequestType(method, bucket, key); len(requestType) > 0 {
+			event["requestType"] = requestType
+		}
+	}
+	if method == http.MethodPut {
+		if _, ok := event["value"]; !ok {
+			event["value"] = body
+		}
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return errorResponse(http.StatusBadRequest, "InvalidRequest", err.Error())
+	}
+
+	if stream, _ := strconv.ParseBool(stringField(event, "stream")); stream &&
+		strings.ToUpper(stringField(event, "requestType")) == "GET_OBJECT" {
+		return streamObject(payload)
+	}
+
+	if err := bolts3router.CheckOpsEvent(payload); err != nil {
+		return awsErrorResponse(err)
+	}
+
+	respMap, err := bolts3router.Route(ctx, payload)
+	if err != nil {
+		return awsErrorResponse(err)
+	}
+
+	respBody, err := json.Marshal(respMap)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, "InternalError", err.Error())
+	}
+
+	return &HTTPResponse{
+		StatusCode: http.StatusOK,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(respBody),
+	}
+}
+
+// streamObject gets the object from Bolt/S3 and returns its data, base64 encoded, as the response body.
+func streamObject(payload []byte) *HTTPResponse {
+
+	var event bolts3opsclient.BoltEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return errorResponse(http.StatusBadRequest, "InvalidRequest", err.Error())
+	}
+
+	boltS3OpsClient := bolts3opsclient.BoltS3OpsClient{}
+	output, err := boltS3OpsClient.GetObjectStream(&event)
+	if err != nil {
+		return awsErrorResponse(err)
+	}
+
+	defer output.Body.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(output.Body, maxStreamedObjectSize+1))
+	if err != nil {
+		return errorResponse(http.StatusBadGateway, "ReadError", err.Error())
+	}
+	if len(data) > maxStreamedObjectSize {
+		return errorResponse(http.StatusRequestEntityTooLarge, "ObjectTooLarge",
+			"object exceeds the maximum size that can be streamed back ("+
+				strconv.Itoa(maxStreamedObjectSize)+" bytes)")
+	}
+
+	headers := map[string]string{"Content-Type": "application/octet-stream"}
+	if output.ContentType != nil {
+		headers["Content-Type"] = *output.ContentType
+	}
+	if output.ETag != nil {
+		headers["ETag"] = *output.ETag
+	}
+	if output.LastModified != nil {
+		headers["Last-Modified"] = output.LastModified.UTC().Format(http.TimeFormat)
+	}
+
+	return &HTTPResponse{
+		StatusCode:      http.StatusOK,
+		Headers:         headers,
+		Body:            base64.StdEncoding.EncodeToString(data),
+		IsBase64Encoded: true,
+	}
+}
+
+// requestPath returns the bucket and key of the request: the 'bucket' and 'key' (or 'proxy') path parameters if
+// defined on the route, otherwise the bucket and key of the /<bucket>/<key> path, percent-decoded if the path is
+// encoded.
+func requestPath(req *HTTPRequest) (string, string, error) {
+	bucket, key := splitPath(req.Path)
+	if req.PathEncoded {
+		var err error
+		if bucket, err = url.PathUnescape(bucket); err != nil {
+			return "", "", err
+		}
+		if key, err = url.PathUnescape(key); err != nil {
+			return "", "", err
+		}
+	}
+	if v, ok := req.PathParameters["proxy"]; ok {
+		bucket, key = splitPath(v)
+	}
+	if v, ok := req.PathParameters["bucket"]; ok {
+		bucket = v
+	}
+	if v, ok := req.PathParameters["key"]; ok {
+		key = v
+	}
+	return bucket, key, nil
+}
+
+// splitPath splits a /<bucket>/<key> path into its bucket and key.
+func splitPath(path string) (string, string) {
+	parts := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2)
+	if len(parts) == 2 {
+		return parts[0], parts[1]
+	}
+	return parts[0], ""
+}
+
+// defaultRequestType derives the requestType from the HTTP method and the presence of bucket and key.
+func defaultRequestType(method string, bucket string, key string) string {
+	switch method {
+	case http.MethodGet:
+		if len(key) > 0 {
+			return "get_object"
+		} else if len(bucket) > 0 {
+			return "list_objects_v2"
+		}
+		return "list_buckets"
+	case http.MethodHead:
+		if len(key) > 0 {
+			return "head_object"
+		}
+		return "head_bucket"
+	case http.MethodPut:
+		return "put_object"
+	case http.MethodDelete:
+		return "delete_object"
+	default:
+		return ""
+	}
+}
+
+// stringField returns the event field as a string, or an empty string if the field is missing.
+func stringField(event map[string]interface{}, name string) string {
+	if v, ok := event[name].(string); ok {
+		return v
+	}
+	return ""
+}
+
+// awsErrorResponse maps an error returned by Bolt/S3 onto an HTTP error response. The status code of the
+// failed Bolt/S3 request is used if available.
+func awsErrorResponse(err error) *HTTPResponse {
+	if reqErr, ok := err.(awserr.RequestFailure); ok && reqErr.StatusCode() > 0 {
+		return errorResponse(reqErr.StatusCode(), reqErr.Code(), reqErr.Message())
+	}
+	if awsErr, ok := err.(awserr.Error); ok {
+		switch awsErr.Code() {
+		case "NoSuchKey", "NoSuchBucket", "NotFound":
+			return errorResponse(http.StatusNotFound, awsErr.Code(), awsErr.Message())
+		default:
+			return errorResponse(http.StatusBadGateway, awsErr.Code(), awsErr.Message())
+		}
+	}
+	if _, ok := err.(*json.UnmarshalTypeError); ok {
+		return errorResponse(http.StatusBadRequest, "InvalidRequest", err.Error())
+	}
+	if _, ok := err.(*json.SyntaxError); ok {
+		return errorResponse(http.StatusBadRequest, "InvalidRequest", err.Error())
+	}
+	if errors.Is(err, bolts3router.ErrUnsupportedHandler) ||
+		errors.Is(err, bolts3opsclient.ErrUnsupportedRequestType) {
+		return errorResponse(http.StatusBadRequest, "InvalidRequest", err.Error())
+	}
+	return errorResponse(http.StatusInternalServerError, "InternalError", err.Error())
+}
+
+// errorResponse returns an HTTP response with a JSON body describing the error.
+func errorResponse(statusCode int, code string, message string) *HTTPResponse {
+	respBody, _ := json.Marshal(map[string]string{"code": code, "message": message})
+	return &HTTPResponse{
+		StatusCode: statusCode,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(respBody),
+	}
+}
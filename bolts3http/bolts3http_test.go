@@ -0,0 +1,238 @@
+package bolts3http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"gitlab.com/projectn-oss/projectn-bolt-go-sample/bolts3opsclient"
+	"gitlab.com/projectn-oss/projectn-bolt-go-sample/bolts3router"
+	"net/http"
+	"testing"
+)
+
+func TestSplitPath(t *testing.T) {
+	tests := []struct {
+		path string
+		bucket string
+		key string
+	}{
+		{path: "", bucket: "", key: ""},
+		{path: "/", bucket: "", key: ""},
+		{path: "/bucket", bucket: "bucket", key: ""},
+		{path: "/bucket/", bucket: "bucket", key: ""},
+		{path: "/bucket/key", bucket: "bucket", key: "key"},
+		{path: "/bucket/dir/sub/key.txt", bucket: "bucket", key: "dir/sub/key.txt"},
+		{path: "bucket/key", bucket: "bucket", key: "key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			bucket, key := splitPath(tt.path)
+			if bucket != tt.bucket || key != tt.key {
+				t.Errorf("splitPath(%q) = %q, %q, want %q, %q", tt.path, bucket, key, tt.bucket, tt.key)
+			}
+		})
+	}
+}
+
+func TestRequestPath(t *testing.T) {
+	tests := []struct {
+		name string
+		req *HTTPRequest
+		bucket string
+		key string
+		wantErr bool
+	}{
+		{
+			name:   "decoded path",
+			req:    &HTTPRequest{Path: "/bucket/dir/my key%.txt"},
+			bucket: "bucket",
+			key:    "dir/my key%.txt",
+		},
+		{
+			name:   "encoded key",
+			req:    &HTTPRequest{Path: "/bucket/dir%2Fsub/my%20key%25.txt", PathEncoded: true},
+			bucket: "bucket",
+			key:    "dir/sub/my key%.txt",
+		},
+		{
+			name:   "encoded bucket",
+			req:    &HTTPRequest{Path: "/my%2Dbucket/key", PathEncoded: true},
+			bucket: "my-bucket",
+			key:    "key",
+		},
+		{
+			name:    "invalid encoding",
+			req:     &HTTPRequest{Path: "/bucket/key%zz", PathEncoded: true},
+			wantErr: true,
+		},
+		{
+			name: "path parameters",
+			req: &HTTPRequest{
+				Path:           "/ignored/path%20",
+				PathEncoded:    true,
+				PathParameters: map[string]string{"bucket": "bucket", "key": "my key"},
+			},
+			bucket: "bucket",
+			key:    "my key",
+		},
+		{
+			name: "proxy path parameter",
+			req: &HTTPRequest{
+				Path:           "/prefix/bucket/key",
+				PathParameters: map[string]string{"proxy": "bucket/dir/key"},
+			},
+			bucket: "bucket",
+			key:    "dir/key",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bucket, key, err := requestPath(tt.req)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("requestPath() error = nil, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("requestPath() error = %v", err)
+			}
+			if bucket != tt.bucket || key != tt.key {
+				t.Errorf("requestPath() = %q, %q, want %q, %q", bucket, key, tt.bucket, tt.key)
+			}
+		})
+	}
+}
+
+func TestProcessRequestInvalidEncoding(t *testing.T) {
+	req := &HTTPRequest{Method: http.MethodGet, Path: "/bucket/key%zz", PathEncoded: true}
+	if resp := ProcessRequest(context.Background(), req); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("StatusCode = %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+}
+
+func TestProcessRequestUnsupportedRequestType(t *testing.T) {
+	req := &HTTPRequest{Method: http.MethodGet, Path: "/bucket/key", QueryStringParameters: map[string]string{
+		"requestType": "copy_object",
+	}}
+	if resp := ProcessRequest(context.Background(), req); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("StatusCode = %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+}
+
+func TestDefaultRequestType(t *testing.T) {
+	tests := []struct {
+		method string
+		bucket string
+		key string
+		requestType string
+	}{
+		{method: http.MethodGet, bucket: "bucket", key: "key", requestType: "get_object"},
+		{method: http.MethodGet, bucket: "bucket", key: "", requestType: "list_objects_v2"},
+		{method: http.MethodGet, bucket: "", key: "", requestType: "list_buckets"},
+		{method: http.MethodHead, bucket: "bucket", key: "key", requestType: "head_object"},
+		{method: http.MethodHead, bucket: "bucket", key: "", requestType: "head_bucket"},
+		{method: http.MethodPut, bucket: "bucket", key: "key", requestType: "put_object"},
+		{method: http.MethodDelete, bucket: "bucket", key: "key", requestType: "delete_object"},
+		{method: http.MethodPost, bucket: "bucket", key: "key", requestType: ""},
+		{method: http.MethodPatch, bucket: "bucket", key: "key", requestType: ""},
+		{method: http.MethodOptions, bucket: "", key: "", requestType: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s /%s/%s", tt.method, tt.bucket, tt.key), func(t *testing.T) {
+			if got := defaultRequestType(tt.method, tt.bucket, tt.key); got != tt.requestType {
+				t.Errorf("defaultRequestType() = %q, want %q", got, tt.requestType)
+			}
+		})
+	}
+}
+
+func TestAWSErrorResponse(t *testing.T) {
+	syntaxErr := json.Unmarshal([]byte("{"), &map[string]interface{}{})
+	typeErr := json.Unmarshal([]byte(`{"a": 1}`), &map[string]string{})
+
+	tests := []struct {
+		name string
+		err error
+		statusCode int
+		code string
+	}{
+		{
+			name:       "request failure",
+			err:        awserr.NewRequestFailure(awserr.New("AccessDenied", "access denied", nil), 403, "id"),
+			statusCode: http.StatusForbidden,
+			code:       "AccessDenied",
+		},
+		{
+			name:       "request failure without status code",
+			err:        awserr.NewRequestFailure(awserr.New("NoSuchKey", "no such key", nil), 0, "id"),
+			statusCode: http.StatusNotFound,
+			code:       "NoSuchKey",
+		},
+		{
+			name:       "no such key",
+			err:        awserr.New("NoSuchKey", "no such key", nil),
+			statusCode: http.StatusNotFound,
+			code:       "NoSuchKey",
+		},
+		{
+			name:       "no such bucket",
+			err:        awserr.New("NoSuchBucket", "no such bucket", nil),
+			statusCode: http.StatusNotFound,
+			code:       "NoSuchBucket",
+		},
+		{
+			name:       "not found",
+			err:        awserr.New("NotFound", "not found", nil),
+			statusCode: http.StatusNotFound,
+			code:       "NotFound",
+		},
+		{
+			name:       "other aws error",
+			err:        awserr.New("InternalError", "internal error", nil),
+			statusCode: http.StatusBadGateway,
+			code:       "InternalError",
+		},
+		{name: "json syntax error", err: syntaxErr, statusCode: http.StatusBadRequest, code: "InvalidRequest"},
+		{name: "json type error", err: typeErr, statusCode: http.StatusBadRequest, code: "InvalidRequest"},
+		{
+			name:       "unsupported handler",
+			err:        fmt.Errorf("%w: Unknown", bolts3router.ErrUnsupportedHandler),
+			statusCode: http.StatusBadRequest,
+			code:       "InvalidRequest",
+		},
+		{
+			name:       "unsupported request type",
+			err:        fmt.Errorf("%w: unknown", bolts3opsclient.ErrUnsupportedRequestType),
+			statusCode: http.StatusBadRequest,
+			code:       "InvalidRequest",
+		},
+		{
+			name:       "other error",
+			err:        errors.New("failure"),
+			statusCode: http.StatusInternalServerError,
+			code:       "InternalError",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := awsErrorResponse(tt.err)
+			if resp.StatusCode != tt.statusCode {
+				t.Errorf("StatusCode = %d, want %d", resp.StatusCode, tt.statusCode)
+			}
+			var body map[string]string
+			if err := json.Unmarshal([]byte(resp.Body), &body); err != nil {
+				t.Fatalf("invalid body %q: %v", resp.Body, err)
+			}
+			if body["code"] != tt.code {
+				t.Errorf("code = %q, want %q", body["code"], tt.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package bolts3opsclient
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"gitlab.com/projectn-oss/projectn-bolt-go-sample/bolts3config"
+	"time"
+)
+
+// AutoHeal attempts to retrieve the object from Bolt repeatedly until it succeeds, which would indicate
+// successful auto-healing of the object, and returns the time taken to do so.
+func AutoHeal(event *BoltEvent) (map[string]interface{}, error) {
+
+	bucket := event.Bucket
+	key := event.Key
+
+	// Create bolt client.
+	clients, err := bolts3config.NewClients(&event.ClientConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	boltSvc := clients.BoltSvc
+
+	// Attempt to retrieve object repeatedly until it succeeds, which would indicate successful
+	// auto-healing of the object.
+	var autoHealTime int64
+	autoHealStartTime := time.Now()
+	for {
+		// Get Object from Bolt.
+		getObjInput := &s3.GetObjectInput{
+			Bucket: aws.String(bucket),
+			Key: aws.String(key),
+		}
+
+		req, _ := boltSvc.GetObjectRequest(getObjInput)
+		req.HTTPRequest.Header.Set("Accept-Encoding", "gzip")
+		if err := req.Send(); err == nil {
+			autoHealTime = time.Since(autoHealStartTime).Milliseconds()
+			// exit on success after auto-heal
+			break
+		}
+	}
+
+	autoHealRespMap := make(map[string]interface{})
+	autoHealRespMap["auto_heal_time"] = fmt.Sprintf("%d ms", autoHealTime)
+	return autoHealRespMap, nil
+}
@@ -3,16 +3,31 @@ package bolts3opsclient
 import (
 	"compress/gzip"
 	"crypto/md5"
+	"errors"
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
-	"gitlab.com/projectn-oss/projectn-bolt-go/bolts3"
+	"gitlab.com/projectn-oss/projectn-bolt-go-sample/bolts3config"
 	"io/ioutil"
 	"strings"
 	"time"
 )
 
+// ErrUnsupportedRequestType is returned by CheckRequestType when the 'requestType' field of an event does not name a
+// supported request.
+var ErrUnsupportedRequestType = errors.New("unsupported requestType")
+
+// supportedRequestTypes are the requests that ProcessEvent sends to Bolt/S3.
+var supportedRequestTypes = map[string]bool{
+	"GET_OBJECT":      true,
+	"LIST_OBJECTS_V2": true,
+	"HEAD_OBJECT":     true,
+	"LIST_BUCKETS":    true,
+	"HEAD_BUCKET":     true,
+	"PUT_OBJECT":      true,
+	"DELETE_OBJECT":   true,
+}
+
 type BoltEvent struct {
 	SdkType string `json:"sdkType"`
 	RequestType string `json:"requestType"`
@@ -20,12 +35,14 @@ type BoltEvent struct {
 	Key string `json:"key"`
 	Value string `json:"value"`
 	BucketClean string `json:"bucketClean"`
+	bolts3config.ClientConfig
 }
 
 type BoltS3OpsClient struct {
 	RequestType string
 	SdkType string
 	boltSvc *s3.S3
+	retryStats *bolts3config.RetryStats
 }
 
 type ListObjectsV2Resp struct {
@@ -47,39 +64,78 @@ func (c *BoltS3OpsClient) ProcessEvent(event *BoltEvent) (map[string]interface{}
 
 	c.RequestType = strings.ToUpper(event.RequestType)
 
-	sess, err := session.NewSession()
-	if err != nil {
+	if err := c.initClient(event); err != nil {
 		return nil, err
 	}
 
-	// create an S3/Bolt Client depending on the 'sdkType'
-	// If sdkType is not specified, create an S3 Client.
-	c.SdkType = strings.ToUpper(event.SdkType)
-	if len(c.SdkType) == 0 || c.SdkType == "S3" {
-		c.boltSvc = s3.New(sess)
-	} else {
-		c.boltSvc = bolts3.New(sess)
-	}
-
 	// Perform an S3 / Bolt operation based on the input 'requestType'
+	var respMap map[string]interface{}
+	var err error
 	switch c.RequestType {
 	case "GET_OBJECT":
-		return c.getObject(event.Bucket, event.Key)
+		respMap, err = c.getObject(event.Bucket, event.Key)
 	case "LIST_OBJECTS_V2":
-		return c.listObjectsV2(event.Bucket)
+		respMap, err = c.listObjectsV2(event.Bucket)
 	case "HEAD_OBJECT":
-		return c.headObject(event.Bucket, event.Key)
+		respMap, err = c.headObject(event.Bucket, event.Key)
 	case "LIST_BUCKETS":
-		return c.listBuckets()
+		respMap, err = c.listBuckets()
 	case "HEAD_BUCKET":
-		return c.headBucket(event.Bucket)
+		respMap, err = c.headBucket(event.Bucket)
 	case "PUT_OBJECT":
-		return c.putObject(event.Bucket, event.Key, event.Value)
+		respMap, err = c.putObject(event.Bucket, event.Key, event.Value)
 	case "DELETE_OBJECT":
-		return c.deleteObject(event.Bucket, event.Key)
+		respMap, err = c.deleteObject(event.Bucket, event.Key)
 	default:
 		return map[string]interface{}{}, nil
 	}
+	if err != nil {
+		return nil, err
+	}
+
+	// no. of requests sent by the client and the retries they needed.
+	respMap["retryStats"] = c.retryStats.Snapshot()
+	return respMap, nil
+}
+
+// CheckRequestType returns an error wrapping ErrUnsupportedRequestType if the requestType does not name a request
+// supported by ProcessEvent, which returns an empty response for such events.
+func CheckRequestType(requestType string) error {
+	if !supportedRequestTypes[strings.ToUpper(requestType)] {
+		return fmt.Errorf("%w: %s", ErrUnsupportedRequestType, requestType)
+	}
+	return nil
+}
+
+// GetObjectStream gets the object from Bolt/S3 and returns the output with its body left open, so that the
+// caller can stream the object data back. The caller is responsible for closing the body.
+func (c *BoltS3OpsClient) GetObjectStream(event *BoltEvent) (*s3.GetObjectOutput, error) {
+
+	if err := c.initClient(event); err != nil {
+		return nil, err
+	}
+
+	return c.boltSvc.GetObject(&s3.GetObjectInput{Bucket: aws.String(event.Bucket), Key: aws.String(event.Key)})
+}
+
+// initClient creates an S3/Bolt Client depending on the 'sdkType', with the retry, backoff and timeout
+// policy passed in the event. If sdkType is not specified, create an S3 Client.
+func (c *BoltS3OpsClient) initClient(event *BoltEvent) error {
+
+	clients, err := bolts3config.NewClients(&event.ClientConfig)
+	if err != nil {
+		return err
+	}
+
+	c.SdkType = strings.ToUpper(event.SdkType)
+	if len(c.SdkType) == 0 || c.SdkType == "S3" {
+		c.boltSvc = clients.S3Svc
+		c.retryStats = clients.S3RetryStats
+	} else {
+		c.boltSvc = clients.BoltSvc
+		c.retryStats = clients.BoltRetryStats
+	}
+	return nil
 }
 
 // Returns a list of 1000 objects from the given bucket in Bolt/S3
@@ -0,0 +1,173 @@
+package bolts3opsclient
+
+import (
+	"compress/gzip"
+	"crypto/md5"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"gitlab.com/projectn-oss/projectn-bolt-go-sample/bolts3config"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"strings"
+)
+
+// ValidateObjResult holds the outcome of validating a single object created in a source bucket.
+type ValidateObjResult struct {
+	Bucket string `json:"bucket"`
+	Key string `json:"key"`
+	S3Md5 string `json:"s3-md5,omitempty"`
+	BoltMd5 string `json:"bolt-md5,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// ValidateObj retrieves the object from Bolt and S3 (if BucketClean is OFF), computes and returns their
+// corresponding MD5 hash. If the object is gzip encoded, object is decompressed before computing its MD5.
+func ValidateObj(event *BoltEvent) (map[string]interface{}, error) {
+
+	var bucketClean string
+	if len(event.BucketClean) > 0 {
+		bucketClean = strings.ToUpper(event.BucketClean)
+	} else {
+		bucketClean = "OFF"
+	}
+
+	clients, err := bolts3config.NewClients(&event.ClientConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	s3Md5, boltS3Md5, err := validateObj(clients.S3Svc, clients.BoltSvc, event.Bucket, event.Key, bucketClean)
+	if err != nil {
+		return nil, err
+	}
+
+	respMap := make(map[string]interface{})
+	respMap["s3-md5"] = s3Md5
+	respMap["bolt-md5"] = boltS3Md5
+	respMap["s3RetryStats"] = clients.S3RetryStats.Snapshot()
+	respMap["boltRetryStats"] = clients.BoltRetryStats.Snapshot()
+	return respMap, nil
+}
+
+// ValidateS3Event performs data validation of every object created in a source bucket, as notified by the
+// records of an S3 event. For each created object, it compares the MD5 hash of the object retrieved from Bolt
+// with the MD5 hash of the object retrieved from S3, and records (logs and returns) mismatches and objects that
+// could not be retrieved. Records of other event types (e.g. ObjectRemoved) are skipped.
+// The retry, backoff and timeout policy of the clients is configured via environment variables.
+func ValidateS3Event(event *events.S3Event) (map[string]interface{}, error) {
+
+	clients, err := bolts3config.NewClients(&bolts3config.ClientConfig{})
+	if err != nil {
+		return nil, err
+	}
+
+	var matched, skipped int
+	mismatches := []ValidateObjResult{}
+	failures := []ValidateObjResult{}
+
+	for _, record := range event.Records {
+		if !strings.HasPrefix(record.EventName, "ObjectCreated:") {
+			skipped++
+			continue
+		}
+
+		// Object keys in S3 event notifications are URL encoded.
+		bucket := record.S3.Bucket.Name
+		key, err := url.QueryUnescape(record.S3.Object.Key)
+		if err != nil {
+			key = record.S3.Object.Key
+		}
+
+		s3Md5, boltS3Md5, err := validateObj(clients.S3Svc, clients.BoltSvc, bucket, key, "OFF")
+		if err != nil {
+			log.Printf("data validation failed: bucket=%s key=%s error=%v", bucket, key, err)
+			failures = append(failures, ValidateObjResult{Bucket: bucket, Key: key, Error: err.Error()})
+			continue
+		}
+
+		if s3Md5 != boltS3Md5 {
+			log.Printf("data validation mismatch: bucket=%s key=%s s3-md5=%s bolt-md5=%s", bucket, key, s3Md5, boltS3Md5)
+			mismatches = append(mismatches, ValidateObjResult{Bucket: bucket, Key: key, S3Md5: s3Md5, BoltMd5: boltS3Md5})
+			continue
+		}
+		matched++
+	}
+
+	respMap := make(map[string]interface{})
+	respMap["matched"] = matched
+	respMap["skipped"] = skipped
+	respMap["mismatched"] = len(mismatches)
+	respMap["failed"] = len(failures)
+	respMap["mismatches"] = mismatches
+	respMap["failures"] = failures
+	respMap["s3RetryStats"] = clients.S3RetryStats.Snapshot()
+	respMap["boltRetryStats"] = clients.BoltRetryStats.Snapshot()
+	return respMap, nil
+}
+
+// validateObj retrieves the object from Bolt and S3 (if bucketClean is OFF) and returns their corresponding
+// MD5 hash. The S3 MD5 hash is empty if bucketClean is not OFF.
+func validateObj(s3Svc *s3.S3, boltSvc *s3.S3, bucket string, key string, bucketClean string) (string, string, error) {
+
+	// Get Object from Bolt.
+	req, boltOutput := boltSvc.GetObjectRequest(&s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	req.HTTPRequest.Header.Set("Accept-Encoding", "gzip")
+	if err := req.Send(); err != nil {
+		return "", "", err
+	}
+
+	defer boltOutput.Body.Close()
+
+	boltS3Md5, err := objectMD5(boltOutput, key)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Get Object from S3 if bucket clean is off.
+	var s3Md5 string
+	if bucketClean == "OFF" {
+		req, s3Output := s3Svc.GetObjectRequest(&s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+		req.HTTPRequest.Header.Set("Accept-Encoding", "gzip")
+		if err := req.Send(); err != nil {
+			return "", "", err
+		}
+
+		defer s3Output.Body.Close()
+
+		s3Md5, err = objectMD5(s3Output, key)
+		if err != nil {
+			return "", "", err
+		}
+	}
+	return s3Md5, boltS3Md5, nil
+}
+
+// objectMD5 computes the MD5 hash of the object data.
+// If the object is gzip encoded, object is decompressed before computing its MD5.
+func objectMD5(output *s3.GetObjectOutput, key string) (string, error) {
+
+	if (output.ContentEncoding != nil && len(*output.ContentEncoding) > 0 && *output.ContentEncoding == "gzip") ||
+		strings.HasSuffix(key, ".gz") {
+
+		gr, err := gzip.NewReader(output.Body)
+		if err != nil {
+			return "", err
+		}
+
+		defer gr.Close()
+		data, err := ioutil.ReadAll(gr)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%X", md5.Sum(data)), nil
+	}
+
+	data, err := ioutil.ReadAll(output.Body)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%X", md5.Sum(data)), nil
+}
@@ -0,0 +1,376 @@
+package bolts3perf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Verdicts of the comparison of a run with a baseline.
+const (
+	baselineVerdictPass = "pass"
+	baselineVerdictFail = "fail"
+)
+
+const (
+	// location of the baselines by default. Local baselines only last as long as the Lambda execution
+	// environment, so baselines are usually saved to S3 / Bolt (s3://<bucket>/<prefix>).
+	defaultBaselinePath = "/tmp/bolt-s3-perf-baselines"
+	// thresholds of the metrics checked against the baseline by default.
+	defaultThresholds = "p50=10%,p99=20%,opsThroughput=10%,errorRate=1"
+)
+
+// baselineMetricUnits are the units of the metrics of the perf stats saved in a baseline. Latency metrics and
+// the error rate regress when they go up, throughput metrics when they go down.
+var baselineMetricUnits = map[string]string{
+	"average":         "ms",
+	"p50":             "ms",
+	"p90":             "ms",
+	"p95":             "ms",
+	"p99":             "ms",
+	"p99.9":           "ms",
+	"opsThroughput":   "ops/s",
+	"bytesThroughput": "bytes/s",
+	"errorRate":       "%",
+}
+
+// Baseline is the perf stats of a run saved under a name, to detect the regressions of later runs. Metrics
+// holds the metrics of each perf stats entry of the run, keyed by the path of the entry in the results, e.g.
+// "bolt_get_obj_perf_stats", "concurrency_8/bolt_get_obj_perf_stats" or "bolt_mixed_perf_stats/get_object".
+type Baseline struct {
+	Name string `json:"name"`
+	SavedAt time.Time `json:"savedAt"`
+	RunParams *RunParams `json:"runParams,omitempty"`
+	Metrics map[string]map[string]float64 `json:"metrics"`
+}
+
+// BaselineSummary describes a baseline saved by a perf run.
+type BaselineSummary struct {
+	Name string `json:"name"`
+	Location string `json:"location"`
+	Stats int `json:"stats"`
+}
+
+// BaselineComparison is the result of the comparison of the Bolt perf stats of a run with those of a baseline:
+// the no. of metrics checked against their threshold, the regressions (the metrics that changed by more than
+// their threshold), and the Bolt perf stats of the baseline that the run did not produce. The verdict is fail
+// if any metric regressed, or if no metric could be checked.
+type BaselineComparison struct {
+	Baseline string `json:"baseline"`
+	Location string `json:"location"`
+	SavedAt time.Time `json:"savedAt"`
+	Thresholds string `json:"thresholds"`
+	Checked int `json:"checked"`
+	Verdict string `json:"verdict"`
+	Reason string `json:"reason,omitempty"`
+	Regressions []MetricRegression `json:"regressions,omitempty"`
+	Missing []string `json:"missing,omitempty"`
+}
+
+// MetricRegression is a metric of a perf stats entry that changed from its baseline value by more than its
+// threshold. Change and Threshold are in % of the baseline value, or in percentage points (pp) for the error
+// rate.
+type MetricRegression struct {
+	Stats string `json:"stats"`
+	Metric string `json:"metric"`
+	Unit string `json:"unit"`
+	Baseline float64 `json:"baseline"`
+	Current float64 `json:"current"`
+	Change float64 `json:"change"`
+	Threshold float64 `json:"threshold"`
+	ChangeUnit string `json:"changeUnit"`
+}
+
+// thresholds is the largest change of each checked metric from its baseline value that is not a regression.
+type thresholds map[string]float64
+
+// parseThresholds parses the thresholds of the metrics, e.g. "p50=10%,p99=20%,opsThroughput=10%,errorRate=1":
+// the largest increase of a latency metric (average, p50, p90, p95, p99, p99.9) or largest decrease of a
+// throughput metric (opsThroughput, bytesThroughput) in % of its baseline value, or the largest increase of the
+// error rate in percentage points.
+func parseThresholds(s string) (thresholds, error) {
+	if len(s) == 0 {
+		s = defaultThresholds
+	}
+
+	t := make(thresholds)
+	for _, pair := range strings.Split(s, ",") {
+		parts := strings.Split(pair, "=")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid thresholds: %s", s)
+		}
+		metric := strings.TrimSpace(parts[0])
+		if _, ok := baselineMetricUnits[metric]; !ok {
+			return nil, fmt.Errorf("invalid thresholds: %s (unknown metric %s)", s, metric)
+		}
+		value, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(parts[1]), "%"), 64)
+		if err != nil || value < 0 {
+			return nil, fmt.Errorf("invalid thresholds: %s", s)
+		}
+		t[metric] = value
+	}
+	return t, nil
+}
+
+// String returns the thresholds in the format of parseThresholds.
+func (t thresholds) String() string {
+	metrics := sortedMetrics(t)
+	for i, metric := range metrics {
+		if metric == "errorRate" {
+			metrics[i] = fmt.Sprintf("%s=%g", metric, t[metric])
+		} else {
+			metrics[i] = fmt.Sprintf("%s=%g%%", metric, t[metric])
+		}
+	}
+	return strings.Join(metrics, ",")
+}
+
+// parseBaselineName checks the name of a baseline, which is used as a file name.
+func parseBaselineName(param string, name string) (string, error) {
+	if strings.ContainsAny(name, "/\\") || name == "." || name == ".." {
+		return "", fmt.Errorf("invalid %s: %s", param, name)
+	}
+	return name, nil
+}
+
+// baselineLocation returns the location of the baseline of the given name under the baseline path: a local
+// directory, or s3://<bucket>/<prefix> or bolt://<bucket>/<prefix>.
+func (p *BoltS3Perf) baselineLocation(name string) string {
+	return strings.TrimSuffix(p.baselinePath, "/") + "/" + name + ".json"
+}
+
+// loadBaseline reads the baseline of the given name, and returns it with its location.
+func (p *BoltS3Perf) loadBaseline(name string) (*Baseline, string, error) {
+
+	location := p.baselineLocation(name)
+	var data []byte
+	if strings.HasPrefix(location, "s3://") || strings.HasPrefix(location, "bolt://") {
+		svc, bucket, key, err := p.objectLocation(location)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid baselinePath: %s", p.baselinePath)
+		}
+		output, err := svc.GetObject(&s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+		if err != nil {
+			return nil, "", fmt.Errorf("baseline %s not found at %s: %w", name, location, err)
+		}
+		defer output.Body.Close()
+		data, err = ioutil.ReadAll(output.Body)
+		if err != nil {
+			return nil, "", err
+		}
+	} else {
+		var err error
+		data, err = ioutil.ReadFile(location)
+		if err != nil {
+			return nil, "", fmt.Errorf("baseline %s not found at %s: %w", name, location, err)
+		}
+	}
+
+	baseline := &Baseline{}
+	if err := json.Unmarshal(data, baseline); err != nil {
+		return nil, "", fmt.Errorf("invalid baseline %s at %s: %w", name, location, err)
+	}
+	return baseline, location, nil
+}
+
+// storeBaseline writes the baseline under the baseline path, replacing any baseline of the same name, and
+// returns its location.
+func (p *BoltS3Perf) storeBaseline(baseline *Baseline) (string, error) {
+
+	data, err := json.MarshalIndent(baseline, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	location := p.baselineLocation(baseline.Name)
+	if strings.HasPrefix(location, "s3://") || strings.HasPrefix(location, "bolt://") {
+		svc, bucket, key, err := p.objectLocation(location)
+		if err != nil {
+			return "", fmt.Errorf("invalid baselinePath: %s", p.baselinePath)
+		}
+		_, err = svc.PutObject(&s3.PutObjectInput{
+			Bucket:      aws.String(bucket),
+			Key:         aws.String(key),
+			Body:        bytes.NewReader(data),
+			ContentType: aws.String("application/json"),
+		})
+		return location, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(location), 0755); err != nil {
+		return "", err
+	}
+	return location, ioutil.WriteFile(location, data, 0644)
+}
+
+// baselineMetrics adds the metrics of each perf stats entry of the results to metrics, keyed by the path of the
+// entry under the given path.
+func baselineMetrics(results map[string]interface{}, path string, metrics map[string]map[string]float64) {
+	for name, value := range results {
+		switch value := value.(type) {
+		case *NumericPerfStats:
+			if entryMetrics := perfStatsMetrics(value); len(entryMetrics) > 0 {
+				metrics[path + name] = entryMetrics
+			}
+		case map[string]interface{}:
+			baselineMetrics(value, path + name + "/", metrics)
+		}
+	}
+}
+
+// perfStatsMetrics returns the metrics of the perf stats saved in a baseline.
+func perfStatsMetrics(s *NumericPerfStats) map[string]float64 {
+	metrics := make(map[string]float64)
+	if s.Latency != nil && s.Latency.Count > 0 {
+		metrics["average"] = s.Latency.Average
+		metrics["p50"] = s.Latency.P50
+		metrics["p90"] = s.Latency.P90
+		metrics["p95"] = s.Latency.P95
+		metrics["p99"] = s.Latency.P99
+		metrics["p99.9"] = s.Latency.P999
+	}
+	if s.OpsThroughput != nil {
+		metrics["opsThroughput"] = s.OpsThroughput.Value
+	}
+	if s.BytesThroughput != nil {
+		metrics["bytesThroughput"] = s.BytesThroughput.Value
+	}
+	if s.Errors != nil {
+		metrics["errorRate"] = s.Errors.Rate.Value
+	}
+	return metrics
+}
+
+// isBoltStats returns whether the path of a perf stats entry is that of Bolt perf stats.
+func isBoltStats(path string) bool {
+	for _, name := range strings.Split(path, "/") {
+		if strings.HasPrefix(name, "bolt_") {
+			return true
+		}
+	}
+	return false
+}
+
+// compareBaseline checks the metrics of the Bolt perf stats of the run against those of the baseline, and
+// returns the regressions: latency metrics and the error rate that went up, and throughput metrics that went
+// down, by more than their threshold.
+func (p *BoltS3Perf) compareBaseline(baseline *Baseline, location string,
+	metrics map[string]map[string]float64) *BaselineComparison {
+
+	comparison := &BaselineComparison{
+		Baseline:   baseline.Name,
+		Location:   location,
+		SavedAt:    baseline.SavedAt,
+		Thresholds: p.thresholds.String(),
+		Verdict:    baselineVerdictPass,
+	}
+
+	paths := make([]string, 0, len(baseline.Metrics))
+	for path := range baseline.Metrics {
+		if isBoltStats(path) {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		current, ok := metrics[path]
+		if !ok {
+			comparison.Missing = append(comparison.Missing, path)
+			continue
+		}
+		for _, metric := range sortedMetrics(p.thresholds) {
+			baselineValue, ok := baseline.Metrics[path][metric]
+			if !ok {
+				continue
+			}
+			currentValue, ok := current[metric]
+			if !ok {
+				continue
+			}
+
+			// change of the metric in the direction of a regression.
+			var change float64
+			changeUnit := "%"
+			switch {
+			case metric == "errorRate":
+				change = currentValue - baselineValue
+				changeUnit = "pp"
+			case baselineValue == 0:
+				continue
+			case baselineMetricUnits[metric] == "ms":
+				change = (currentValue - baselineValue) / baselineValue * 100
+			default:
+				change = (baselineValue - currentValue) / baselineValue * 100
+			}
+			comparison.Checked++
+			if change > p.thresholds[metric] {
+				comparison.Regressions = append(comparison.Regressions, MetricRegression{
+					Stats:      path,
+					Metric:     metric,
+					Unit:       baselineMetricUnits[metric],
+					Baseline:   baselineValue,
+					Current:    currentValue,
+					Change:     change,
+					Threshold:  p.thresholds[metric],
+					ChangeUnit: changeUnit,
+				})
+			}
+		}
+	}
+
+	if len(comparison.Regressions) > 0 {
+		comparison.Verdict = baselineVerdictFail
+		comparison.Reason = fmt.Sprintf("%d of %d metrics regressed", len(comparison.Regressions),
+			comparison.Checked)
+	} else if comparison.Checked == 0 {
+		comparison.Verdict = baselineVerdictFail
+		comparison.Reason = "no metric of the Bolt perf stats of the run could be checked against the baseline"
+	}
+	return comparison
+}
+
+// sortedMetrics returns the metrics of the thresholds in alphabetical order.
+func sortedMetrics(t thresholds) []string {
+	metrics := make([]string, 0, len(t))
+	for metric := range t {
+		metrics = append(metrics, metric)
+	}
+	sort.Strings(metrics)
+	return metrics
+}
+
+// processBaselines compares the perf stats of the run with the baseline to compare with, if any, and saves
+// them as a baseline if a name was passed. The comparison is returned under "baseline_comparison", and the
+// saved baseline under "baseline".
+func (p *BoltS3Perf) processBaselines(perfStats map[string]interface{}) error {
+
+	metrics := make(map[string]map[string]float64)
+	baselineMetrics(perfStats, "", metrics)
+
+	if p.baseline != nil {
+		perfStats["baseline_comparison"] = p.compareBaseline(p.baseline, p.baselineSource, metrics)
+	}
+
+	if len(p.saveBaseline) > 0 {
+		baseline := &Baseline{Name: p.saveBaseline, SavedAt: time.Now().UTC(), Metrics: metrics}
+		if runParams, ok := perfStats["run_params"].(*RunParams); ok {
+			baseline.RunParams = runParams
+		}
+		location, err := p.storeBaseline(baseline)
+		if err != nil {
+			return err
+		}
+		perfStats["baseline"] = &BaselineSummary{Name: baseline.Name, Location: location, Stats: len(metrics)}
+	}
+	return nil
+}
@@ -0,0 +1,303 @@
+package bolts3perf
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestParseThresholds(t *testing.T) {
+	tests := []struct {
+		name string
+		s string
+		want thresholds
+		wantErr bool
+	}{
+		{
+			name: "default",
+			s:    "",
+			want: thresholds{"p50": 10, "p99": 20, "opsThroughput": 10, "errorRate": 1},
+		},
+		{
+			name: "percent suffix",
+			s:    "p50=5%,p99.9=25%",
+			want: thresholds{"p50": 5, "p99.9": 25},
+		},
+		{
+			name: "without percent suffix",
+			s:    "average=5,bytesThroughput=12.5",
+			want: thresholds{"average": 5, "bytesThroughput": 12.5},
+		},
+		{
+			name: "error rate in percentage points",
+			s:    "errorRate=0.5",
+			want: thresholds{"errorRate": 0.5},
+		},
+		{
+			name: "spaces",
+			s:    " p90 = 15% , p95=0",
+			want: thresholds{"p90": 15, "p95": 0},
+		},
+		{name: "unknown metric", s: "p50=10%,p75=10%", wantErr: true},
+		{name: "missing =", s: "p50", wantErr: true},
+		{name: "several =", s: "p50=10=20", wantErr: true},
+		{name: "negative value", s: "p50=-10%", wantErr: true},
+		{name: "invalid value", s: "p50=ten", wantErr: true},
+		{name: "double percent suffix", s: "p50=10%%", wantErr: true},
+		{name: "empty entry", s: "p50=10%,", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseThresholds(tt.s)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseThresholds(%q) = %v, want an error", tt.s, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseThresholds(%q) error = %v", tt.s, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseThresholds(%q) = %v, want %v", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestThresholdsString(t *testing.T) {
+	th, err := parseThresholds("p99=20%,errorRate=1,p50=10%")
+	if err != nil {
+		t.Fatalf("parseThresholds() error = %v", err)
+	}
+	if got, want := th.String(), "errorRate=1,p50=10%,p99=20%"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if parsed, err := parseThresholds(th.String()); err != nil || !reflect.DeepEqual(parsed, th) {
+		t.Errorf("parseThresholds(%q) = %v, %v, want %v", th.String(), parsed, err, th)
+	}
+}
+
+func TestCompareBaseline(t *testing.T) {
+	const boltStats = "bolt_get_obj_perf_stats"
+
+	tests := []struct {
+		name string
+		thresholds string
+		baseline map[string]map[string]float64
+		current map[string]map[string]float64
+		verdict string
+		checked int
+		// changes of the regressed metrics, keyed by metric.
+		regressions map[string]float64
+		missing []string
+	}{
+		{
+			name:       "latency within threshold",
+			thresholds: "p50=10%",
+			baseline:   map[string]map[string]float64{boltStats: {"p50": 100}},
+			current:    map[string]map[string]float64{boltStats: {"p50": 109}},
+			verdict:    baselineVerdictPass,
+			checked:    1,
+		},
+		{
+			name:        "latency regression",
+			thresholds:  "p50=10%",
+			baseline:    map[string]map[string]float64{boltStats: {"p50": 100}},
+			current:     map[string]map[string]float64{boltStats: {"p50": 111}},
+			verdict:     baselineVerdictFail,
+			checked:     1,
+			regressions: map[string]float64{"p50": 11},
+		},
+		{
+			name:       "latency improvement",
+			thresholds: "p50=10%",
+			baseline:   map[string]map[string]float64{boltStats: {"p50": 100}},
+			current:    map[string]map[string]float64{boltStats: {"p50": 50}},
+			verdict:    baselineVerdictPass,
+			checked:    1,
+		},
+		{
+			name:        "throughput regression",
+			thresholds:  "opsThroughput=10%",
+			baseline:    map[string]map[string]float64{boltStats: {"opsThroughput": 1000}},
+			current:     map[string]map[string]float64{boltStats: {"opsThroughput": 850}},
+			verdict:     baselineVerdictFail,
+			checked:     1,
+			regressions: map[string]float64{"opsThroughput": 15},
+		},
+		{
+			name:       "throughput improvement",
+			thresholds: "opsThroughput=10%",
+			baseline:   map[string]map[string]float64{boltStats: {"opsThroughput": 1000}},
+			current:    map[string]map[string]float64{boltStats: {"opsThroughput": 2000}},
+			verdict:    baselineVerdictPass,
+			checked:    1,
+		},
+		{
+			name:        "error rate regression in percentage points",
+			thresholds:  "errorRate=1",
+			baseline:    map[string]map[string]float64{boltStats: {"errorRate": 1}},
+			current:     map[string]map[string]float64{boltStats: {"errorRate": 2.5}},
+			verdict:     baselineVerdictFail,
+			checked:     1,
+			regressions: map[string]float64{"errorRate": 1.5},
+		},
+		{
+			name:       "error rate within threshold",
+			thresholds: "errorRate=1",
+			baseline:   map[string]map[string]float64{boltStats: {"errorRate": 10}},
+			current:    map[string]map[string]float64{boltStats: {"errorRate": 10.8}},
+			verdict:    baselineVerdictPass,
+			checked:    1,
+		},
+		{
+			name:       "zero error rate baseline",
+			thresholds: "errorRate=1",
+			baseline:   map[string]map[string]float64{boltStats: {"errorRate": 0}},
+			current:    map[string]map[string]float64{boltStats: {"errorRate": 0.5}},
+			verdict:    baselineVerdictPass,
+			checked:    1,
+		},
+		{
+			name:       "zero baseline skipped",
+			thresholds: "p50=10%,p99=10%",
+			baseline:   map[string]map[string]float64{boltStats: {"p50": 0, "p99": 100}},
+			current:    map[string]map[string]float64{boltStats: {"p50": 50, "p99": 105}},
+			verdict:    baselineVerdictPass,
+			checked:    1,
+		},
+		{
+			name:       "only zero baselines",
+			thresholds: "p50=10%",
+			baseline:   map[string]map[string]float64{boltStats: {"p50": 0}},
+			current:    map[string]map[string]float64{boltStats: {"p50": 50}},
+			verdict:    baselineVerdictFail,
+			checked:    0,
+		},
+		{
+			name:       "metrics without threshold",
+			thresholds: "p50=10%",
+			baseline:   map[string]map[string]float64{boltStats: {"p99": 100}},
+			current:    map[string]map[string]float64{boltStats: {"p99": 500}},
+			verdict:    baselineVerdictFail,
+			checked:    0,
+		},
+		{
+			name:       "s3 perf stats not checked",
+			thresholds: "p50=10%",
+			baseline:   map[string]map[string]float64{"s3_get_obj_perf_stats": {"p50": 100}},
+			current:    map[string]map[string]float64{"s3_get_obj_perf_stats": {"p50": 500}},
+			verdict:    baselineVerdictFail,
+			checked:    0,
+		},
+		{
+			name:       "missing perf stats",
+			thresholds: "p50=10%",
+			baseline: map[string]map[string]float64{
+				boltStats:                          {"p50": 100},
+				"concurrency_8/" + boltStats:       {"p50": 100},
+				"bolt_mixed_perf_stats/get_object": {"p50": 100},
+			},
+			current: map[string]map[string]float64{"concurrency_8/" + boltStats: {"p50": 105}},
+			verdict: baselineVerdictPass,
+			checked: 1,
+			missing: []string{boltStats, "bolt_mixed_perf_stats/get_object"},
+		},
+		{
+			name:       "no perf stats",
+			thresholds: "p50=10%",
+			baseline:   map[string]map[string]float64{boltStats: {"p50": 100}},
+			current:    map[string]map[string]float64{},
+			verdict:    baselineVerdictFail,
+			checked:    0,
+			missing:    []string{boltStats},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			th, err := parseThresholds(tt.thresholds)
+			if err != nil {
+				t.Fatalf("parseThresholds(%q) error = %v", tt.thresholds, err)
+			}
+			p := &BoltS3Perf{thresholds: th}
+			comparison := p.compareBaseline(&Baseline{Name: "baseline", Metrics: tt.baseline}, "location", tt.current)
+
+			if comparison.Verdict != tt.verdict {
+				t.Errorf("Verdict = %q, want %q", comparison.Verdict, tt.verdict)
+			}
+			if comparison.Verdict == baselineVerdictFail && len(comparison.Reason) == 0 {
+				t.Error("empty Reason")
+			}
+			if comparison.Checked != tt.checked {
+				t.Errorf("Checked = %d, want %d", comparison.Checked, tt.checked)
+			}
+			if !reflect.DeepEqual(comparison.Missing, tt.missing) {
+				t.Errorf("Missing = %v, want %v", comparison.Missing, tt.missing)
+			}
+
+			if len(comparison.Regressions) != len(tt.regressions) {
+				t.Fatalf("%d regressions, want %d: %+v", len(comparison.Regressions), len(tt.regressions),
+					comparison.Regressions)
+			}
+			for _, r := range comparison.Regressions {
+				want, ok := tt.regressions[r.Metric]
+				if !ok {
+					t.Errorf("unexpected regression of %s", r.Metric)
+					continue
+				}
+				if math.Abs(r.Change - want) > 1e-9 {
+					t.Errorf("%s: Change = %g, want %g", r.Metric, r.Change, want)
+				}
+				if r.Threshold != th[r.Metric] {
+					t.Errorf("%s: Threshold = %g, want %g", r.Metric, r.Threshold, th[r.Metric])
+				}
+				wantUnit := "%"
+				if r.Metric == "errorRate" {
+					wantUnit = "pp"
+				}
+				if r.ChangeUnit != wantUnit {
+					t.Errorf("%s: ChangeUnit = %q, want %q", r.Metric, r.ChangeUnit, wantUnit)
+				}
+			}
+		})
+	}
+}
+
+func TestBaselineMetrics(t *testing.T) {
+	stats := &NumericPerfStats{
+		Latency: &NumericPerfStat{
+			Unit:    "ms",
+			Count:   10,
+			Average: 12,
+			P50:     10,
+			P90:     20,
+			P95:     25,
+			P99:     30,
+			P999:    40,
+		},
+		OpsThroughput: &Metric{Value: 500, Unit: "ops/s"},
+	}
+	results := map[string]interface{}{
+		"bolt_get_obj_perf_stats": stats,
+		"concurrency_8":           map[string]interface{}{"s3_get_obj_perf_stats": stats},
+		"s3Count":                 &NumericObjectCount{Compressed: 1},
+		"empty_perf_stats":        &NumericPerfStats{},
+	}
+
+	metrics := make(map[string]map[string]float64)
+	baselineMetrics(results, "", metrics)
+
+	want := map[string]float64{"average": 12, "p50": 10, "p90": 20, "p95": 25, "p99": 30, "p99.9": 40,
+		"opsThroughput": 500}
+	if len(metrics) != 2 {
+		t.Errorf("%d perf stats entries, want 2: %v", len(metrics), metrics)
+	}
+	for _, path := range []string{"bolt_get_obj_perf_stats", "concurrency_8/s3_get_obj_perf_stats"} {
+		if !reflect.DeepEqual(metrics[path], want) {
+			t.Errorf("metrics[%q] = %v, want %v", path, metrics[path], want)
+		}
+	}
+}
@@ -1,35 +1,108 @@
 package bolts3perf
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
-	"gitlab.com/projectn-oss/projectn-bolt-go/bolts3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"gitlab.com/projectn-oss/projectn-bolt-go-sample/bolts3config"
 	"io"
-	"math/rand"
-	"sort"
+	"io/ioutil"
+	"net/http"
 	"strconv"
 	"strings"
 	"time"
 )
 
+// contentEncodingGzip is the content encoding of gzip compressed uploads.
+const contentEncodingGzip = "GZIP"
+
+// defaultMultipartThreshold is the size from which objects are uploaded using multipart uploads by default.
+const defaultMultipartThreshold = 100 << 20
+
 type PerfEvent struct {
 	RequestType string `json:"requestType"`
 	Bucket string `json:"bucket"`
 	Key string `json:"key"`
 	NumKeys string `json:"numKeys"`
+	Prefix string `json:"prefix"`
+	KeySampling string `json:"keySampling"`
+	Manifest string `json:"manifest"`
+	RangeSize string `json:"rangeSize"`
+	RangeOffset string `json:"rangeOffset"`
 	ObjLength string `json:"objLength"`
 	NumIter string `json:"numIter"`
+	Concurrency string `json:"concurrency"`
+	Duration string `json:"duration"`
+	Rate string `json:"rate"`
+	Ordering string `json:"ordering"`
+	Warmup string `json:"warmup"`
+	SizeDistribution string `json:"sizeDistribution"`
+	MultipartThreshold string `json:"multipartThreshold"`
+	PartSize string `json:"partSize"`
+	PartConcurrency string `json:"partConcurrency"`
+	PayloadType string `json:"payloadType"`
+	ContentEncoding string `json:"contentEncoding"`
+	Mix string `json:"mix"`
+	KeyDistribution string `json:"keyDistribution"`
+	OutputFormat string `json:"outputFormat"`
+	ExportFormat string `json:"exportFormat"`
+	ExportPath string `json:"exportPath"`
+	KeepObjects string `json:"keepObjects"`
+	ErrorBudget string `json:"errorBudget"`
+	SaveBaseline string `json:"saveBaseline"`
+	CompareBaseline string `json:"compareBaseline"`
+	BaselinePath string `json:"baselinePath"`
+	Thresholds string `json:"thresholds"`
+	bolts3config.ClientConfig
 }
 
 type BoltS3Perf struct {
 	requestType string
 	boltSvc *s3.S3
 	s3Svc *s3.S3
+	clients *bolts3config.Clients
 	numKeys int
+	prefix string
+	keySampling string
+	manifest string
+	objectSizes objectSizes
+	rangeSize int64
+	rangeOffset string
 	objLength int
+	sizes sizeDistribution
+	multipartThreshold int64
+	partSize int64
+	partConcurrency int
+	generator payloadGenerator
+	contentEncoding string
 	numIter int
+	concurrency int
+	duration time.Duration
+	rate float64
+	ordering string
+	warmup int
+	outputFormat string
+	workload *workload
+	exporter *exporter
+	// error budget of the run, in error-tolerant mode.
+	errorBudget *errorBudget
+	// name under which the perf stats of the run are saved as a baseline, the baseline they are compared with
+	// (and its location), the location of the baselines and the thresholds of the checked metrics.
+	saveBaseline string
+	baseline *Baseline
+	baselineSource string
+	baselinePath string
+	thresholds thresholds
+	// unique prefix of the keys of the objects created by the run, whether the objects are kept once the run is
+	// complete, and the time at which the run is stopped to leave time for the cleanup.
+	runID string
+	runPrefix string
+	keepObjects bool
+	deadline time.Time
 	keys []string
 }
 
@@ -38,12 +111,54 @@ type PerfStats struct {
 	Throughput  *PerfStat `json:"throughput,omitempty"`
 	ThroughputT string   `json:"throughputT,omitempty"`
 	ObjectSize *PerfStat `json:"objectSize,omitempty"`
+	CorrectedLatency *PerfStat `json:"correctedLatency,omitempty"`
+	PartLatency *PerfStat `json:"partLatency,omitempty"`
+	TransferThroughput *PerfStat `json:"transferThroughput,omitempty"`
+	Concurrency int `json:"concurrency,omitempty"`
+	TargetRate string `json:"targetRate,omitempty"`
+	OpsThroughput string `json:"opsThroughput,omitempty"`
+	BytesThroughput string `json:"bytesThroughput,omitempty"`
+	SizeBuckets []SizeBucket `json:"sizeBuckets,omitempty"`
+	Errors *ErrorStats `json:"errors,omitempty"`
+	Phases *PhaseStats `json:"phases,omitempty"`
+	LatencyHdrHistogram string `json:"latencyHdrHistogram,omitempty"`
+	CorrectedLatencyHdrHistogram string `json:"correctedLatencyHdrHistogram,omitempty"`
 }
 
 type PerfStat struct {
 	Average string `json:"average"`
 	P50 string `json:"p50"`
 	P90 string `json:"p90"`
+	Count int `json:"count"`
+	Min string `json:"min"`
+	Max string `json:"max"`
+	StdDev string `json:"stddev"`
+	P95 string `json:"p95"`
+	P99 string `json:"p99"`
+	P999 string `json:"p99.9"`
+	Histogram []HistogramBucket `json:"histogram,omitempty"`
+}
+
+type PhaseStats struct {
+	DNS *PerfStat `json:"dns,omitempty"`
+	Connect *PerfStat `json:"connect,omitempty"`
+	TLS *PerfStat `json:"tls,omitempty"`
+	Write *PerfStat `json:"write,omitempty"`
+	FirstByte *PerfStat `json:"firstByte,omitempty"`
+	Transfer *PerfStat `json:"transfer,omitempty"`
+}
+
+type ErrorStats struct {
+	Requests int64 `json:"requests"`
+	Failed int64 `json:"failed"`
+	Rate string `json:"rate"`
+	Breakdown []ErrorCount `json:"breakdown,omitempty"`
+}
+
+type SizeBucket struct {
+	UpperBound string `json:"le"`
+	Count int64 `json:"count"`
+	Throughput string `json:"throughput"`
 }
 
 type ObjectCount struct {
@@ -51,9 +166,46 @@ type ObjectCount struct {
 	Uncompressed string `json:"uncompressed"`
 }
 
+type Comparison struct {
+	S3Count int64 `json:"s3Count"`
+	BoltCount int64 `json:"boltCount"`
+	Confidence string `json:"confidence"`
+	Percentiles []PercentileComparison `json:"percentiles,omitempty"`
+	MannWhitneyU *MannWhitneyU `json:"mannWhitneyU,omitempty"`
+	Verdict string `json:"verdict"`
+	Summary string `json:"summary"`
+}
+
+type PercentileComparison struct {
+	Percentile string `json:"percentile"`
+	S3 string `json:"s3"`
+	Bolt string `json:"bolt"`
+	Ratio string `json:"ratio,omitempty"`
+	Difference string `json:"difference"`
+}
+
+// maxCleanupReserve is the longest time reserved for the cleanup of a run before the deadline of its context.
+const maxCleanupReserve = time.Minute
+
 // ProcessEvent extracts the parameters (requestType, bucket) from the event, uses those
 // parameters to run performance testing against Bolt / S3 and returns back performance statistics.
 func (p *BoltS3Perf) ProcessEvent(event *PerfEvent) (map[string]interface{}, error)  {
+	return p.ProcessEventWithContext(context.Background(), event)
+}
+
+// ProcessEventWithContext processes the event as ProcessEvent does. If the context has a deadline (e.g. the
+// timeout of a Lambda function), perf tests are stopped before the deadline, leaving a fifth of the remaining
+// time (at most a minute) to delete the objects created by the run, and ErrRunTimeout is returned.
+func (p *BoltS3Perf) ProcessEventWithContext(ctx context.Context,
+	event *PerfEvent) (map[string]interface{}, error) {
+
+	if deadline, ok := ctx.Deadline(); ok {
+		reserve := time.Until(deadline) / 5
+		if reserve > maxCleanupReserve {
+			reserve = maxCleanupReserve
+		}
+		p.deadline = deadline.Add(-reserve)
+	}
 
 	// If requestType is not passed, perform all perf tests.
 	if len(event.RequestType) > 0 {
@@ -68,12 +220,46 @@ func (p *BoltS3Perf) ProcessEvent(event *PerfEvent) (map[string]interface{}, err
 		if err != nil {
 			return nil, err
 		}
+		if numKeys < 1 {
+			return nil, fmt.Errorf("invalid numKeys: %d", numKeys)
+		}
 		p.numKeys = numKeys
 	} else {
 		p.numKeys = 1000
 	}
-	if p.numKeys > 1000 {
-		p.numKeys = 1000
+
+	// prefix of the keys of get object perf tests, and whether the keys are the first keys or a random sample
+	// of the keys listed from the bucket or read from the manifest.
+	p.prefix = event.Prefix
+	p.manifest = event.Manifest
+	p.keySampling = strings.ToUpper(event.KeySampling)
+	if len(p.keySampling) == 0 {
+		p.keySampling = keySamplingFirst
+	}
+	if p.keySampling != keySamplingFirst && p.keySampling != keySamplingRandom {
+		return nil, fmt.Errorf("invalid keySampling: %s", event.KeySampling)
+	}
+
+	// size of the ranges read by get object range, and the pattern of their offsets in each object.
+	p.rangeSize = defaultRangeSize
+	if len(event.RangeSize) > 0 {
+		rangeSize, err := parseSize(event.RangeSize)
+		if err != nil {
+			return nil, err
+		}
+		if rangeSize < 1 {
+			return nil, fmt.Errorf("invalid rangeSize: %s", event.RangeSize)
+		}
+		p.rangeSize = rangeSize
+	}
+	p.rangeOffset = strings.ToUpper(event.RangeOffset)
+	if len(p.rangeOffset) == 0 {
+		p.rangeOffset = rangeOffsetStart
+	}
+	switch p.rangeOffset {
+	case rangeOffsetStart, rangeOffsetEnd, rangeOffsetRandom, rangeOffsetSequential:
+	default:
+		return nil, fmt.Errorf("invalid rangeOffset: %s", event.RangeOffset)
 	}
 
 	if len(event.ObjLength) > 0 {
@@ -86,441 +272,781 @@ func (p *BoltS3Perf) ProcessEvent(event *PerfEvent) (map[string]interface{}, err
 		p.objLength = 100
 	}
 
-	// initialize S3 and Bolt clients
-	sess, err := session.NewSession()
+	// size distribution of uploaded objects (objLength bytes if none is passed), and the size from which
+	// objects are uploaded using multipart uploads.
+	sizes, err := parseSizeDistribution(event.SizeDistribution, int64(p.objLength))
 	if err != nil {
 		return nil, err
 	}
-	p.s3Svc = s3.New(sess)
-	p.boltSvc = bolts3.New(sess)
-
-	// If Put, Delete, All Object Perf test then generate key names.
-	// If Get Object Perf Test (including passthrough), list objects (up to numKeys) to get key names.
-	if p.requestType == "PUT_OBJECT" ||
-		p.requestType == "DELETE_OBJECT" ||
-		p.requestType == "ALL" {
-		p.generateKeyNames(p.numKeys)
-	} else if p.requestType == "GET_OBJECT" ||
-		p.requestType == "GET_OBJECT_PASSTHROUGH" ||
-		p.requestType == "GET_OBJECT_TTFB" ||
-		p.requestType == "GET_OBJECT_PASSTHROUGH_TTFB" {
-		err := p.listObjectsV2(event.Bucket)
+	p.sizes = sizes
+	p.multipartThreshold = defaultMultipartThreshold
+	if len(event.MultipartThreshold) > 0 {
+		p.multipartThreshold, err = parseSize(event.MultipartThreshold)
 		if err != nil {
 			return nil, err
 		}
+		if p.multipartThreshold < s3manager.MinUploadPartSize {
+			return nil, fmt.Errorf("invalid multipartThreshold: %s (less than 5 MiB)", event.MultipartThreshold)
+		}
 	}
-
-	//Perform Perf Test depending on the requestType.
-	switch p.requestType {
-	case "LIST_OBJECTS_V2":
-		return p.listObjectsV2Perf(event.Bucket)
-	case "PUT_OBJECT":
-		return p.putObjectPerf(event.Bucket)
-	case "DELETE_OBJECT":
-		return p.deleteObjectPerf(event.Bucket)
-	case "GET_OBJECT", "GET_OBJECT_TTFB":
-		return p.getObjectPerf(event.Bucket)
-	case "GET_OBJECT_PASSTHROUGH", "GET_OBJECT_PASSTHROUGH_TTFB":
-		return p.getObjectPassthroughPerf(event.Bucket)
-	case "ALL":
-		return p.allPerf(event.Bucket)
-	default:
-		return map[string]interface{}{}, nil
+	if p.requestType == "PUT_OBJECT_MULTIPART" {
+		// all objects are uploaded using the uploader, which uploads objects smaller than a part in one request.
+		p.multipartThreshold = 0
 	}
-}
-
-// listObjectsV2Perf measures the List Objects V2 performance (latency, throughput) of Bolt / S3.
-func (p *BoltS3Perf) listObjectsV2Perf(bucket string) (map[string]interface{}, error) {
-
-	var s3ListObjTimes []int64
-	var boltListObjTimes []int64
-	var s3ListObjTp []float64
-	var boltListObjTp []float64
-	p.numIter = 10
-
-	// list 1000 objects from S3, numIter times.
-	for i := 0; i < p.numIter; i++ {
 
-		req := &s3.ListObjectsV2Input{
-			Bucket: aws.String(bucket),
-			MaxKeys: aws.Int64(int64(p.numKeys)),
+	// size of the parts of multipart uploads and parallel downloads, and the no. of parts transferred at a time.
+	p.partSize = s3manager.DefaultUploadPartSize
+	if len(event.PartSize) > 0 {
+		p.partSize, err = parseSize(event.PartSize)
+		if err != nil {
+			return nil, err
 		}
-
-		start := time.Now()
-		resp, err := p.s3Svc.ListObjectsV2(req)
+		if p.partSize < s3manager.MinUploadPartSize {
+			return nil, fmt.Errorf("invalid partSize: %s (less than 5 MiB)", event.PartSize)
+		}
+	}
+	p.partConcurrency = s3manager.DefaultUploadConcurrency
+	if len(event.PartConcurrency) > 0 {
+		p.partConcurrency, err = strconv.Atoi(event.PartConcurrency)
 		if err != nil {
 			return nil, err
 		}
-		
-		// calc latency
-		listObjTime := time.Since(start).Milliseconds()
-		s3ListObjTimes = append(s3ListObjTimes, listObjTime)
-
-		// calc throughput
-		listObjV2Tp := float64(*resp.KeyCount) / float64(listObjTime)
-		s3ListObjTp = append(s3ListObjTp, listObjV2Tp)
+		if p.partConcurrency < 1 {
+			return nil, fmt.Errorf("invalid partConcurrency: %d", p.partConcurrency)
+		}
 	}
 
-	// list 1000 objects from Bolt, numIter times.
-	for i := 0; i < p.numIter; i++ {
+	// type of the generated data of uploaded objects, and whether objects are uploaded gzip compressed.
+	p.generator, err = parsePayloadType(event.PayloadType)
+	if err != nil {
+		return nil, err
+	}
+	p.contentEncoding = strings.ToUpper(event.ContentEncoding)
+	if len(p.contentEncoding) > 0 && p.contentEncoding != contentEncodingGzip {
+		return nil, fmt.Errorf("invalid contentEncoding: %s", event.ContentEncoding)
+	}
 
-		req := &s3.ListObjectsV2Input{
-			Bucket: aws.String(bucket),
-			MaxKeys: aws.Int64(int64(p.numKeys)),
+	// update no. of iterations over the keys (list requests for list objects), if passed as input.
+	// Otherwise each key is used once and objects are listed 10 times.
+	if len(event.NumIter) > 0 {
+		numIter, err := strconv.Atoi(event.NumIter)
+		if err != nil {
+			return nil, err
+		}
+		if numIter < 1 {
+			return nil, fmt.Errorf("invalid numIter: %d", numIter)
 		}
+		p.numIter = numIter
+	}
 
-		start := time.Now()
-		resp, err := p.boltSvc.ListObjectsV2(req)
+	// If duration is passed, each operation is run repeatedly over the keys until the duration has elapsed,
+	// instead of numIter times.
+	if len(event.Duration) > 0 {
+		duration, err := bolts3config.ParseDuration(event.Duration)
 		if err != nil {
 			return nil, err
 		}
+		p.duration = duration
+	}
 
-		// calc latency
-		listObjTime := time.Since(start).Milliseconds()
-		boltListObjTimes = append(boltListObjTimes, listObjTime)
-
-		// calc throughput
-		listObjV2Tp := float64(*resp.KeyCount) / float64(listObjTime)
-		boltListObjTp = append(boltListObjTp, listObjV2Tp)
+	// If a target rate (requests/s) is passed, requests are sent open-loop at that rate, and latencies are also
+	// measured from the intended start of each request.
+	if len(event.Rate) > 0 {
+		rate, err := strconv.ParseFloat(event.Rate, 64)
+		if err != nil {
+			return nil, err
+		}
+		if rate <= 0 {
+			return nil, fmt.Errorf("invalid rate: %s", event.Rate)
+		}
+		p.rate = rate
 	}
 
-	// calc s3 perf stats.
-	s3ListObjPerfStats := p.computePerfStats(s3ListObjTimes, s3ListObjTp, nil)
+	// order of the requests against S3 and Bolt: sequential (default), alternating or random, and the no. of
+	// warmup requests sent to each target before the requests of each test.
+	p.ordering = strings.ToUpper(event.Ordering)
+	if len(p.ordering) == 0 {
+		p.ordering = orderingSequential
+	}
+	switch p.ordering {
+	case orderingSequential, orderingAlternating, orderingRandom:
+	default:
+		return nil, fmt.Errorf("invalid ordering: %s", event.Ordering)
+	}
+	if len(event.Warmup) > 0 {
+		p.warmup, err = strconv.Atoi(event.Warmup)
+		if err != nil {
+			return nil, err
+		}
+		if p.warmup < 0 {
+			return nil, fmt.Errorf("invalid warmup: %d", p.warmup)
+		}
+	}
 
-	// calc bolt perf stats.
-	boltListObjPerfStats := p.computePerfStats(boltListObjTimes, boltListObjTp, nil)
+	// If an error budget is passed, failed requests are counted by error code and HTTP status instead of failing
+	// the run, until they exceed the budget.
+	if len(event.ErrorBudget) > 0 {
+		p.errorBudget, err = parseErrorBudget(event.ErrorBudget)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	listObjPerfRespMap := make(map[string]interface{})
-	listObjPerfRespMap["s3_list_objects_v2_perf_stats"] = s3ListObjPerfStats
-	listObjPerfRespMap["bolt_list_objects_v2_perf_stats"] = boltListObjPerfStats
-	return listObjPerfRespMap, nil
-}
+	// output format of the perf stats: text (default) or numeric. Runs that save or compare a baseline return
+	// numeric perf stats by default.
+	if len(event.OutputFormat) > 0 {
+		p.outputFormat = strings.ToUpper(event.OutputFormat)
+	} else if len(event.SaveBaseline) > 0 || len(event.CompareBaseline) > 0 {
+		p.outputFormat = outputFormatNumeric
+	} else {
+		p.outputFormat = outputFormatText
+	}
+	if p.outputFormat != outputFormatNumeric && p.outputFormat != outputFormatText {
+		return nil, fmt.Errorf("invalid outputFormat: %s", event.OutputFormat)
+	}
 
-// putObjectPerf measures the Put Object performance (latency, throughput) of Bolt / S3.
-func (p *BoltS3Perf) putObjectPerf(bucket string) (map[string]interface{}, error) {
-	var s3PutObjTimes []int64
-	var boltPutObjTimes []int64
+	// If a baseline name is passed, the perf stats of the run are saved as a baseline under that name, or
+	// compared with the baseline of that name to detect regressions. Baselines hold numeric perf stats.
+	compareBaseline := event.CompareBaseline
+	if len(event.SaveBaseline) > 0 || len(compareBaseline) > 0 {
+		if p.outputFormat != outputFormatNumeric {
+			return nil, fmt.Errorf("invalid outputFormat: %s (baselines require numeric perf stats)",
+				event.OutputFormat)
+		}
+		if p.saveBaseline, err = parseBaselineName("saveBaseline", event.SaveBaseline); err != nil {
+			return nil, err
+		}
+		if compareBaseline, err = parseBaselineName("compareBaseline", compareBaseline); err != nil {
+			return nil, err
+		}
+		p.baselinePath = event.BaselinePath
+		if len(p.baselinePath) == 0 {
+			p.baselinePath = defaultBaselinePath
+		}
+		if p.thresholds, err = parseThresholds(event.Thresholds); err != nil {
+			return nil, err
+		}
+	}
 
-	// Upload object to Bolt / S3.
-	for _, key := range p.keys {
-		value := p.generate(p.objLength)
+	// concurrency levels (no. of concurrent requests) at which perf tests are run, e.g. "1,8,32".
+	concurrencyLevels := []int{1}
+	if len(event.Concurrency) > 0 {
+		concurrencyLevels = nil
+		for _, level := range strings.Split(event.Concurrency, ",") {
+			concurrency, err := strconv.Atoi(strings.TrimSpace(level))
+			if err != nil {
+				return nil, err
+			}
+			if concurrency < 1 {
+				return nil, fmt.Errorf("invalid concurrency: %d", concurrency)
+			}
+			concurrencyLevels = append(concurrencyLevels, concurrency)
+		}
+	}
+	maxConcurrency := 0
+	for _, concurrency := range concurrencyLevels {
+		if concurrency > maxConcurrency {
+			maxConcurrency = concurrency
+		}
+	}
 
-		putObjInput := &s3.PutObjectInput{
-			Bucket: aws.String(bucket),
-			Key: aws.String(key),
-			Body: strings.NewReader(value),
+	// initialize S3 and Bolt clients with the retry, backoff and timeout policy passed in the event,
+	// keeping enough idle connections open for the concurrent requests.
+	policy, err := event.ClientConfig.Policy()
+	if err != nil {
+		return nil, err
+	}
+	policy.MaxIdleConnsPerHost = maxConcurrency
+	clients, err := policy.NewClients()
+	if err != nil {
+		return nil, err
+	}
+	p.clients = clients
+	p.s3Svc = clients.S3Svc
+	p.boltSvc = clients.BoltSvc
+
+	// If Put, Delete, All Object Perf test then generate key names under a unique run prefix, and delete the
+	// objects under that prefix once the run is complete unless they are kept (copies of the Copy Object Perf test
+	// are also created under the run prefix).
+	// If Get, Head, Copy Object Perf Test (including passthrough and ranges), list objects or read the manifest
+	// to get (up to numKeys) key names.
+	if len(event.KeepObjects) > 0 {
+		p.keepObjects, err = strconv.ParseBool(event.KeepObjects)
+		if err != nil {
+			return nil, fmt.Errorf("invalid keepObjects: %s", event.KeepObjects)
+		}
+	}
+	if p.requestType == "PUT_OBJECT" ||
+		p.requestType == "PUT_OBJECT_MULTIPART" ||
+		p.requestType == "DELETE_OBJECT" ||
+		p.requestType == "ALL" ||
+		p.requestType == "MIXED" ||
+		p.requestType == "COPY_OBJECT" {
+		p.runID, err = newRunID()
+		if err != nil {
+			return nil, err
+		}
+		p.runPrefix = runKeyPrefix + "/" + p.runID + "/"
+	}
+	if p.requestType == "PUT_OBJECT" ||
+		p.requestType == "PUT_OBJECT_MULTIPART" ||
+		p.requestType == "DELETE_OBJECT" ||
+		p.requestType == "ALL" ||
+		p.requestType == "MIXED" {
+		p.generateKeyNames(p.numKeys)
+	} else if p.requestType == "GET_OBJECT" ||
+		p.requestType == "GET_OBJECT_PASSTHROUGH" ||
+		p.requestType == "GET_OBJECT_TTFB" ||
+		p.requestType == "GET_OBJECT_PASSTHROUGH_TTFB" ||
+		p.requestType == "GET_OBJECT_RANGE" ||
+		p.requestType == "GET_OBJECT_PARALLEL" ||
+		p.requestType == "HEAD_OBJECT" ||
+		p.requestType == "COPY_OBJECT" {
+		err := p.loadKeys(event.Bucket)
+		if err != nil {
+			return nil, err
 		}
+	}
 
-		// Upload object to s3.
-		start := time.Now()
-		_, err := p.s3Svc.PutObject(putObjInput)
+	// mix of operations and key distribution of a mixed workload.
+	if p.requestType == "MIXED" {
+		p.workload, err = newWorkload(event.Mix, event.KeyDistribution, len(p.keys))
 		if err != nil {
 			return nil, err
 		}
+	}
 
-		// calc latency
-		putObjTime := time.Since(start).Milliseconds()
-		s3PutObjTimes = append(s3PutObjTimes, putObjTime)
+	// If an export path is passed, export the raw record of each request (csv or jsonl) to the path.
+	if len(event.ExportPath) > 0 {
+		p.exporter, err = p.newExporter(event.ExportFormat, event.ExportPath)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-		// Upload object to Bolt.
-		start = time.Now()
-		_, err = p.boltSvc.PutObject(putObjInput)
+	// read the baseline to compare with before the run, so that a missing baseline does not waste a run.
+	if len(compareBaseline) > 0 {
+		p.baseline, p.baselineSource, err = p.loadBaseline(compareBaseline)
 		if err != nil {
 			return nil, err
 		}
+	}
 
-		// calc latency
-		putObjTime = time.Since(start).Milliseconds()
-		boltPutObjTimes = append(boltPutObjTimes, putObjTime)
+	startTime := time.Now()
+
+	// Perform Perf Test at each concurrency level. If there are several levels, the perf stats of
+	// each level are returned under 'concurrency_<level>'. Objects created by the run are deleted
+	// afterwards, even if the run failed.
+	perfStats, cleanup, err := p.runPerfTestsAndCleanup(event.Bucket, concurrencyLevels)
+	if err != nil && cleanup != nil {
+		err = fmt.Errorf("%w (cleanup: deleted %d S3 and %d Bolt objects under %s, %d failed)", err,
+			cleanup.S3Deleted, cleanup.BoltDeleted, cleanup.Prefix, cleanup.Failed)
 	}
 
-	// calc s3 perf stats.
-	s3PutObjPerfStats := p.computePerfStats(s3PutObjTimes, nil, nil)
+	// export the records of the requests, including those of a failed run.
+	var exportSummary *ExportSummary
+	if p.exporter != nil {
+		var exportErr error
+		exportSummary, exportErr = p.exporter.close()
+		if err == nil {
+			err = exportErr
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(perfStats) == 0 {
+		return perfStats, nil
+	}
+	if exportSummary != nil {
+		perfStats["export"] = exportSummary
+	}
+	if cleanup != nil {
+		perfStats["cleanup"] = cleanup
+	}
 
-	// calc bolt perf stats.
-	boltPutObjPerfStats := p.computePerfStats(boltPutObjTimes, nil, nil)
+	// no. of requests sent to S3 / Bolt (including the cleanup) and the retries they needed.
+	perfStats["s3_retry_stats"] = p.clients.S3RetryStats.Snapshot()
+	perfStats["bolt_retry_stats"] = p.clients.BoltRetryStats.Snapshot()
+
+	// parameters of the run, along with numeric perf stats.
+	if p.outputFormat == outputFormatNumeric {
+		runParams := &RunParams{
+			RequestType: strings.ToLower(p.requestType),
+			Bucket:      event.Bucket,
+			RunID:       p.runID,
+			KeyPrefix:   p.runPrefix,
+			NumKeys:     len(p.keys),
+			Prefix:      p.prefix,
+			Manifest:    p.manifest,
+			ObjLength:   p.objLength,
+			SizeDistribution: p.sizes.String(),
+			PayloadType: p.generator.String(),
+			ContentEncoding: strings.ToLower(p.contentEncoding),
+			NumIter:     p.numIter,
+			Concurrency: concurrencyLevels,
+			Ordering:    strings.ToLower(p.ordering),
+			Warmup:      p.warmup,
+			Region:      aws.StringValue(p.s3Svc.Config.Region),
+			StartTime:   startTime.UTC(),
+			EndTime:     time.Now().UTC(),
+		}
+		if len(p.runPrefix) == 0 || p.requestType == "ALL" || p.requestType == "COPY_OBJECT" {
+			runParams.KeySampling = strings.ToLower(p.keySampling)
+		}
+		if p.requestType == "GET_OBJECT_RANGE" {
+			runParams.RangeSize = p.rangeSize
+			runParams.RangeOffset = strings.ToLower(p.rangeOffset)
+		}
+		if p.requestType == "PUT_OBJECT_MULTIPART" || p.requestType == "GET_OBJECT_PARALLEL" {
+			runParams.PartSize = p.partSize
+			runParams.PartConcurrency = p.partConcurrency
+		}
+		if p.workload != nil {
+			runParams.Mix = p.workload.String()
+			runParams.KeyDistribution = strings.ToLower(p.workload.distribution)
+		}
+		if p.rate > 0 {
+			runParams.Rate = &Metric{Value: p.rate, Unit: "requests/s"}
+		}
+		if p.errorBudget != nil {
+			runParams.ErrorBudget = p.errorBudget.String()
+		}
+		if p.duration > 0 {
+			runParams.Duration = &Metric{Value: durationMs(p.duration), Unit: "ms"}
+		}
+		perfStats["run_params"] = runParams
+	}
 
-	putObjPerfRespMap := make(map[string]interface{})
-	putObjPerfRespMap["s3_put_obj_perf_stats"] = s3PutObjPerfStats
-	putObjPerfRespMap["bolt_put_obj_perf_stats"] = boltPutObjPerfStats
-	return putObjPerfRespMap, nil
+	// compare the perf stats of the run with the baseline, and save them as a baseline.
+	if err := p.processBaselines(perfStats); err != nil {
+		return nil, err
+	}
+	return perfStats, nil
 }
 
-// deleteObjectPerf Measures the Delete Object performance (latency, throughput) of Bolt/S3.
-func (p *BoltS3Perf) deleteObjectPerf(bucket string) (map[string]interface{}, error) {
-	var s3DelObjTimes []int64
-	var boltDelObjTimes []int64
-
-	// Delete Objects from Bolt / S3.
-	for _, key := range p.keys {
+// runPerfTests performs the Perf Test at each concurrency level.
+func (p *BoltS3Perf) runPerfTests(bucket string, concurrencyLevels []int) (map[string]interface{}, error) {
 
-		delObjInput := &s3.DeleteObjectInput{
-			Bucket: aws.String(bucket),
-			Key: aws.String(key),
-		}
+	if len(concurrencyLevels) == 1 {
+		p.concurrency = concurrencyLevels[0]
+		return p.runPerfTest(bucket)
+	}
 
-		// Delete object from S3.
-		start := time.Now()
-		_, err := p.s3Svc.DeleteObject(delObjInput)
+	perfStats := make(map[string]interface{})
+	for _, concurrency := range concurrencyLevels {
+		p.concurrency = concurrency
+		levelPerfStats, err := p.runPerfTest(bucket)
 		if err != nil {
 			return nil, err
 		}
+		perfStats[fmt.Sprintf("concurrency_%d", concurrency)] = levelPerfStats
+	}
+	return perfStats, nil
+}
 
-		// calc latency
-		delObjTime := time.Since(start).Milliseconds()
-		s3DelObjTimes = append(s3DelObjTimes, delObjTime)
+// runPerfTest performs the Perf Test depending on the requestType.
+func (p *BoltS3Perf) runPerfTest(bucket string) (map[string]interface{}, error) {
+	switch p.requestType {
+	case "LIST_OBJECTS_V2":
+		return p.listObjectsV2Perf(bucket)
+	case "PUT_OBJECT":
+		return p.putObjectPerf(bucket)
+	case "DELETE_OBJECT":
+		return p.deleteObjectPerf(bucket)
+	case "GET_OBJECT", "GET_OBJECT_TTFB":
+		return p.getObjectPerf(bucket)
+	case "GET_OBJECT_PASSTHROUGH", "GET_OBJECT_PASSTHROUGH_TTFB":
+		return p.getObjectPassthroughPerf(bucket)
+	case "GET_OBJECT_RANGE":
+		return p.getObjectRangePerf(bucket)
+	case "HEAD_OBJECT":
+		return p.headObjectPerf(bucket)
+	case "COPY_OBJECT":
+		return p.copyObjectPerf(bucket)
+	case "PUT_OBJECT_MULTIPART":
+		return p.putObjectMultipartPerf(bucket)
+	case "GET_OBJECT_PARALLEL":
+		return p.getObjectParallelPerf(bucket)
+	case "ALL":
+		return p.allPerf(bucket)
+	case "MIXED":
+		return p.mixedPerf(bucket)
+	default:
+		return map[string]interface{}{}, nil
+	}
+}
 
-		// Delete object from Bolt.
-		start = time.Now()
-		_, err = p.boltSvc.DeleteObject(delObjInput)
-		if err != nil {
-			return nil, err
-		}
+// listObjectsV2Perf measures the List Objects V2 performance (latency, throughput) of Bolt / S3.
+func (p *BoltS3Perf) listObjectsV2Perf(bucket string) (map[string]interface{}, error) {
 
-		// calc latency
-		delObjTime = time.Since(start).Milliseconds()
-		boltDelObjTimes = append(boltDelObjTimes, delObjTime)
+	numIter := p.numIter
+	if numIter == 0 {
+		numIter = 10
 	}
 
-	// calc s3 perf stats.
-	s3DelObjPerfStats := p.computePerfStats(s3DelObjTimes, nil, nil)
-
-	// calc bolt perf stats.
-	boltDelObjPerfStats := p.computePerfStats(boltDelObjTimes, nil, nil)
+	// list 1000 objects from S3 and Bolt, numIter times (10 by default).
+	runs, err := p.runTargets("list_objects_v2", p.targets(), numIter, p.warmup, func(svc *s3.S3,
+		i int) (opResult, error) {
+		return p.listObjectsPage(svc, bucket)
+	})
+	if err != nil {
+		return nil, err
+	}
 
-	delObjPerfRespMap := make(map[string]interface{})
-	delObjPerfRespMap["s3_del_obj_perf_stats"] = s3DelObjPerfStats
-	delObjPerfRespMap["bolt_del_obj_perf_stats"] = boltDelObjPerfStats
-	return delObjPerfRespMap, nil
+	// calc perf stats, with the throughput (objects/ms) of each list request.
+	listObjPerfRespMap := make(map[string]interface{})
+	listObjPerfRespMap["s3_list_objects_v2_perf_stats"] = p.output(p.runStats(runs[0], true, false))
+	listObjPerfRespMap["bolt_list_objects_v2_perf_stats"] = p.output(p.runStats(runs[1], true, false))
+	listObjPerfRespMap["list_objects_v2_comparison"] = p.outputComparison(compareRuns(runs[0], runs[1]))
+	return listObjPerfRespMap, nil
 }
 
-// getObjectPerf measures the Get Object performance (latency, throughput) of Bolt / S3.
-func (p *BoltS3Perf) getObjectPerf(bucket string) (map[string]interface{}, error) {
-	var s3GetObjTimes []int64
-	var boltGetObjTimes []int64
+// listObjectsPage lists a page of objects from the given Bolt / S3 client and measures the request.
+func (p *BoltS3Perf) listObjectsPage(svc *s3.S3, bucket string) (opResult, error) {
 
-	var s3ObjSizes []int64
-	var boltObjSizes []int64
+	req, resp := svc.ListObjectsV2Request(&s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		MaxKeys: aws.Int64(int64(p.numKeys)),
+	})
 
-	s3CmpObjCount := 0
-	s3UnCmpObjCount := 0
-	boltCmpObjCount := 0
-	boltUnCmpObjCount := 0
+	result := opResult{start: time.Now()}
+	err := send(req, &result)
 
-	// Get Objects from S3.
-	for _, key := range p.keys {
+	// calc latency
+	result.latency = time.Since(result.start)
+	if err != nil {
+		return result, err
+	}
+	result.objects = *resp.KeyCount
+	return result, nil
+}
 
-		getObjInput := &s3.GetObjectInput{
-			Bucket: aws.String(bucket),
-			Key: aws.String(key),
-		}
+// putObjectPerf measures the Put Object performance (latency, throughput) of Bolt / S3.
+func (p *BoltS3Perf) putObjectPerf(bucket string) (map[string]interface{}, error) {
 
-		req, output := p.s3Svc.GetObjectRequest(getObjInput)
-		req.HTTPRequest.Header.Set("Accept-Encoding", "gzip")
-		start := time.Now()
-		if err := req.Send(); err != nil {
-			return nil, err
+	// Upload an object for each key, numIter times, to S3 and Bolt, with the same size and data for both.
+	seed := time.Now().UnixNano()
+	runs, err := p.runTargets("put_object", p.targets(), p.numOps(), p.warmup, func(svc *s3.S3,
+		i int) (opResult, error) {
+		rng := opRand(seed, i)
+		return p.putObject(svc, bucket, p.keys[i % len(p.keys)], p.sizes.next(rng), rng.Int63())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	putObjPerfRespMap := make(map[string]interface{})
+	putObjPerfRespMap["s3_put_obj_perf_stats"] = p.output(p.runStats(runs[0], false, true))
+	putObjPerfRespMap["bolt_put_obj_perf_stats"] = p.output(p.runStats(runs[1], false, true))
+	putObjPerfRespMap["put_obj_comparison"] = p.outputComparison(compareRuns(runs[0], runs[1]))
+	return putObjPerfRespMap, nil
+}
+
+// putObject uploads an object of size bytes, with data that is generated from seed as it is uploaded, and
+// measures the upload. Objects of at least multipartThreshold bytes are uploaded using a multipart
+// upload, in parts of partSize bytes, partConcurrency parts at a time. If the content encoding is gzip, the data
+// is gzip compressed and uploaded with 'Content-Encoding: gzip'; objects below the multipart threshold are
+// compressed before the upload is started, and larger objects are compressed as they are uploaded, so that the
+// compression is part of the measured latency.
+func (p *BoltS3Perf) putObject(svc *s3.S3, bucket string, key string, size int64, seed int64) (opResult, error) {
+
+	var body io.ReadSeeker = newPayload(size, seed, p.generator)
+	result := opResult{key: key, bytes: size}
+	var contentEncoding *string
+
+	if p.contentEncoding == contentEncodingGzip {
+		contentEncoding = aws.String("gzip")
+		result.compressed = true
+		if size < p.multipartThreshold {
+			var compressed bytes.Buffer
+			gw := gzip.NewWriter(&compressed)
+			if _, err := io.Copy(gw, body); err != nil {
+				return result, err
+			}
+			if err := gw.Close(); err != nil {
+				return result, err
+			}
+			body = bytes.NewReader(compressed.Bytes())
+			result.bytes = int64(compressed.Len())
 		}
+	}
 
-		// If getting first byte object latency, read at most 1 byte,
-		// otherwise read the entire body.
-		if p.requestType == "GET_OBJECT_TTFB" {
-			// read only the first byte from the stream.
-			buf := make([]byte, 1)
-			_, _ = output.Body.Read(buf)
-		} else {
-			// read all data from the stream.
-			buf := make([]byte, 4096)
-			for {
-				_, err := output.Body.Read(buf)
-				if err == io.EOF {
-					break
+	if size >= p.multipartThreshold {
+		// compress the data as it is uploaded, since its compressed size is not known in advance.
+		var reader io.Reader = body
+		var counter *countingReader
+		var pr *io.PipeReader
+		if result.compressed {
+			var pw *io.PipeWriter
+			pr, pw = io.Pipe()
+			go func(data io.Reader) {
+				gw := gzip.NewWriter(pw)
+				_, err := io.Copy(gw, data)
+				if err == nil {
+					err = gw.Close()
 				}
-			}
+				pw.CloseWithError(err)
+			}(body)
+			counter = &countingReader{Reader: pr}
+			reader = counter
 		}
 
-		// calc latency
-		getObjTime := time.Since(start).Milliseconds()
-		s3GetObjTimes = append(s3GetObjTimes, getObjTime)
+		parts := &partLatencies{}
+		uploader := p.newUploader(svc, parts)
+		result.start = time.Now()
+		_, err := uploader.Upload(&s3manager.UploadInput{
+			Bucket: aws.String(bucket),
+			Key: aws.String(key),
+			Body: reader,
+			ContentEncoding: contentEncoding,
+		})
 
-		// count object.
-		if (output.ContentEncoding != nil &&
-			len(*output.ContentEncoding) > 0 && *output.ContentEncoding == "gzip") ||
-			strings.HasSuffix(key, ".gz") {
-			s3CmpObjCount++
-		} else {
-			s3UnCmpObjCount++
+		// calc latency
+		result.latency = time.Since(result.start)
+		if pr != nil {
+			// unblock the compressing goroutine if the upload stopped reading before the end of the data.
+			if err != nil {
+				pr.CloseWithError(err)
+			} else {
+				pr.Close()
+			}
 		}
-
-		// get object sizes.
-		s3ObjSizes = append(s3ObjSizes, *output.ContentLength)
-		// close response stream.
-		output.Body.Close()
+		if counter != nil {
+			result.bytes = counter.n
+		}
+		result.parts = parts.get()
+		result.retries = parts.retryCount()
+		if err != nil {
+			return result, err
+		}
+		result.status = http.StatusOK
+		return result, nil
 	}
 
-	// Get Objects from Bolt.
-	for _, key := range p.keys {
+	req, _ := svc.PutObjectRequest(&s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key: aws.String(key),
+		Body: body,
+		ContentEncoding: contentEncoding,
+	})
+	result.start = time.Now()
+	err := send(req, &result)
 
-		getObjInput := &s3.GetObjectInput{
-			Bucket: aws.String(bucket),
-			Key: aws.String(key),
-		}
+	// calc latency
+	result.latency = time.Since(result.start)
+	return result, err
+}
 
-		req, output := p.boltSvc.GetObjectRequest(getObjInput)
-		req.HTTPRequest.Header.Set("Accept-Encoding", "gzip")
-		start := time.Now()
-		if err := req.Send(); err != nil {
-			return nil, err
-		}
+// countingReader counts the bytes read from the reader.
+type countingReader struct {
+	io.Reader
+	n int64
+}
 
-		// If getting first byte object latency, read at most 1 byte,
-		// otherwise read the entire body.
-		if p.requestType == "GET_OBJECT_TTFB" {
-			// read only the first byte from the stream.
-			buf := make([]byte, 1)
-			_, _ = output.Body.Read(buf)
-		} else {
-			// read all data from the stream.
-			buf := make([]byte, 4096)
-			for {
-				_, err := output.Body.Read(buf)
-				if err == io.EOF {
-					break
-				}
-			}
-		}
+func (r *countingReader) Read(b []byte) (int, error) {
+	n, err := r.Reader.Read(b)
+	r.n += int64(n)
+	return n, err
+}
 
-		// calc latency
-		getObjTime := time.Since(start).Milliseconds()
-		boltGetObjTimes = append(boltGetObjTimes, getObjTime)
+// deleteObjectPerf Measures the Delete Object performance (latency, throughput) of Bolt/S3. Each object can
+// only be deleted once, so delete requests are not warmed up. In the delete object test, an object is first
+// uploaded (unmeasured) to S3 and Bolt for each key; in the all test, the objects are those of the put object test.
+// Objects left over are deleted by the cleanup of the run.
+func (p *BoltS3Perf) deleteObjectPerf(bucket string) (map[string]interface{}, error) {
 
-		// count object.
-		if (output.ContentEncoding != nil &&
-			len(*output.ContentEncoding) > 0 && *output.ContentEncoding == "gzip") ||
-			strings.HasSuffix(key, ".gz") {
-			boltCmpObjCount++
-		} else {
-			boltUnCmpObjCount++
+	if p.requestType == "DELETE_OBJECT" {
+		seed := time.Now().UnixNano()
+		for _, svc := range p.targets() {
+			svc := svc
+			if err := forEachKey(p.keys, p.concurrency, func(i int, key string) error {
+				rng := opRand(seed, i)
+				_, err := p.putObject(svc, bucket, key, p.sizes.next(rng), rng.Int63())
+				return err
+			}); err != nil {
+				return nil, err
+			}
 		}
+	}
 
-		// get object sizes.
-		boltObjSizes = append(boltObjSizes, *output.ContentLength)
-		// close response stream.
-		output.Body.Close()
+	// Delete the object of each key, numIter times, from S3 and Bolt.
+	runs, err := p.runTargets("delete_object", p.targets(), p.numOps(), 0, func(svc *s3.S3,
+		i int) (opResult, error) {
+		return p.deleteObject(svc, bucket, p.keys[i % len(p.keys)])
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	// calc s3 perf stats.
-	s3GetObjPerfStats := p.computePerfStats(s3GetObjTimes, nil, s3ObjSizes)
+	delObjPerfRespMap := make(map[string]interface{})
+	delObjPerfRespMap["s3_del_obj_perf_stats"] = p.output(p.runStats(runs[0], false, false))
+	delObjPerfRespMap["bolt_del_obj_perf_stats"] = p.output(p.runStats(runs[1], false, false))
+	delObjPerfRespMap["del_obj_comparison"] = p.outputComparison(compareRuns(runs[0], runs[1]))
+	return delObjPerfRespMap, nil
+}
+
+// deleteObject deletes the object of the key from the given Bolt / S3 client and measures the request.
+func (p *BoltS3Perf) deleteObject(svc *s3.S3, bucket string, key string) (opResult, error) {
+
+	req, _ := svc.DeleteObjectRequest(&s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key: aws.String(key),
+	})
 
-	// calc bolt perf stats.
-	boltGetObjPerfStats := p.computePerfStats(boltGetObjTimes, nil, boltObjSizes)
+	result := opResult{key: key, start: time.Now()}
+	err := send(req, &result)
+
+	// calc latency
+	result.latency = time.Since(result.start)
+	return result, err
+}
+
+// getObjectPerf measures the Get Object performance (latency, throughput) of Bolt / S3.
+func (p *BoltS3Perf) getObjectPerf(bucket string) (map[string]interface{}, error) {
 
-	var s3GetObjStatName, boltGetObjStatName string
-	if p.requestType == "GET_OBJECT_TTFB" {
+	ttfb := p.requestType == "GET_OBJECT_TTFB"
+
+	// Get the object of each key, numIter times, from S3 and Bolt.
+	runs, err := p.runTargets(getObjectOperation(ttfb), p.targets(), p.numOps(), p.warmup, func(svc *s3.S3,
+		i int) (opResult, error) {
+		return p.getObject(svc, bucket, p.keys[i % len(p.keys)], ttfb)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s3GetObjPerfStats, s3Count := p.getObjectStats(runs[0], ttfb)
+	boltGetObjPerfStats, boltCount := p.getObjectStats(runs[1], ttfb)
+
+	var s3GetObjStatName, boltGetObjStatName, getObjComparisonName string
+	if ttfb {
 		s3GetObjStatName = "s3_get_obj_ttfb_perf_stats"
 		boltGetObjStatName = "bolt_get_obj_ttfb_perf_stats"
+		getObjComparisonName = "get_obj_ttfb_comparison"
 	} else {
 		s3GetObjStatName = "s3_get_obj_perf_stats"
 		boltGetObjStatName = "bolt_get_obj_perf_stats"
-	}
-
-	s3Count := &ObjectCount{
-		Compressed:   fmt.Sprintf("%d", s3CmpObjCount),
-		Uncompressed: fmt.Sprintf("%d", s3UnCmpObjCount),
-	}
-
-	boltCount := &ObjectCount{
-		Compressed:   fmt.Sprintf("%d", boltCmpObjCount),
-		Uncompressed: fmt.Sprintf("%d", boltUnCmpObjCount),
+		getObjComparisonName = "get_obj_comparison"
 	}
 
 	getObjPerfRespMap := make(map[string]interface{})
-	getObjPerfRespMap[s3GetObjStatName] = s3GetObjPerfStats
-	getObjPerfRespMap[boltGetObjStatName] = boltGetObjPerfStats
-	getObjPerfRespMap["s3Count"] = s3Count
-	getObjPerfRespMap["boltCount"] = boltCount
+	getObjPerfRespMap[s3GetObjStatName] = p.output(s3GetObjPerfStats)
+	getObjPerfRespMap[boltGetObjStatName] = p.output(boltGetObjPerfStats)
+	getObjPerfRespMap[getObjComparisonName] = p.outputComparison(compareRuns(runs[0], runs[1]))
+	getObjPerfRespMap["s3Count"] = p.outputCount(s3Count)
+	getObjPerfRespMap["boltCount"] = p.outputCount(boltCount)
 	return getObjPerfRespMap, nil
 }
 
 // getObjectPassthroughPerf measures the Get Object passthrough performance (latency, throughput) of Bolt / S3.
 func (p *BoltS3Perf) getObjectPassthroughPerf(bucket string) (map[string]interface{}, error) {
-	var boltGetObjTimes []int64
 
-	var boltObjSizes []int64
+	ttfb := p.requestType == "GET_OBJECT_PASSTHROUGH_TTFB"
 
-	boltCmpObjCount := 0
-	boltUnCmpObjCount := 0
+	// Get the object of each key, numIter times, via passthrough from Bolt.
+	runs, err := p.runTargets(getObjectOperation(ttfb), []*s3.S3{p.boltSvc}, p.numOps(), p.warmup,
+		func(svc *s3.S3, i int) (opResult, error) {
+			return p.getObject(svc, bucket, p.keys[i % len(p.keys)], ttfb)
+		})
+	if err != nil {
+		return nil, err
+	}
+	boltGetObjPtPerfStats, boltCount := p.getObjectStats(runs[0], ttfb)
 
-	// Get Objects via passthrough from Bolt.
-	for _, key := range p.keys {
+	var boltGetObjPtStatName string
+	if ttfb {
+		boltGetObjPtStatName = "bolt_get_obj_pt_ttfb_perf_stats"
+	} else {
+		boltGetObjPtStatName = "bolt_get_obj_pt_perf_stats"
+	}
 
-		getObjInput := &s3.GetObjectInput{
-			Bucket: aws.String(bucket),
-			Key: aws.String(key),
-		}
+	getObjPtPerfRespMap := make(map[string]interface{})
+	getObjPtPerfRespMap[boltGetObjPtStatName] = p.output(boltGetObjPtPerfStats)
+	getObjPtPerfRespMap["boltCount"] = p.outputCount(boltCount)
+	return getObjPtPerfRespMap, nil
+}
 
-		req, output := p.boltSvc.GetObjectRequest(getObjInput)
-		req.HTTPRequest.Header.Set("Accept-Encoding", "gzip")
-		start := time.Now()
-		if err := req.Send(); err != nil {
-			return nil, err
-		}
+// getObjectOperation returns the name of the get object operation, or of the get object (first byte) operation
+// if ttfb is set.
+func getObjectOperation(ttfb bool) string {
+	if ttfb {
+		return "get_object_ttfb"
+	}
+	return "get_object"
+}
 
-		// If getting first byte object latency, read at most 1 byte,
-		// otherwise read the entire body.
-		if p.requestType == "GET_OBJECT_PASSTHROUGH_TTFB" {
-			// read only the first byte from the stream.
-			buf := make([]byte, 1)
-			_, _ = output.Body.Read(buf)
-		} else {
-			// read all data from the stream.
-			buf := make([]byte, 4096)
-			for {
-				_, err := output.Body.Read(buf)
-				if err == io.EOF {
-					break
-				}
-			}
-		}
+// getObject gets the object of the key from the given Bolt / S3 client, reading the entire body (or at most 1
+// byte if ttfb is set), and measures the request.
+func (p *BoltS3Perf) getObject(svc *s3.S3, bucket string, key string, ttfb bool) (opResult, error) {
 
-		// calc latency
-		getObjTime := time.Since(start).Milliseconds()
-		boltGetObjTimes = append(boltGetObjTimes, getObjTime)
+	getObjInput := &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key: aws.String(key),
+	}
 
-		// count object.
-		if (output.ContentEncoding != nil &&
-			len(*output.ContentEncoding) > 0 && *output.ContentEncoding == "gzip") ||
-			strings.HasSuffix(key, ".gz") {
-			boltCmpObjCount++
-		} else {
-			boltUnCmpObjCount++
+	req, output := svc.GetObjectRequest(getObjInput)
+	req.HTTPRequest.Header.Set("Accept-Encoding", "gzip")
+	result := opResult{key: key, start: time.Now()}
+	if err := send(req, &result); err != nil {
+		result.latency = time.Since(result.start)
+		return result, err
+	}
+
+	// If getting first byte object latency, read at most 1 byte,
+	// otherwise read the entire body.
+	var err error
+	if ttfb {
+		// read only the first byte from the stream.
+		buf := make([]byte, 1)
+		if _, err = output.Body.Read(buf); err == io.EOF {
+			err = nil
 		}
+	} else {
+		// read all data from the stream.
+		_, err = io.Copy(ioutil.Discard, output.Body)
+	}
 
-		// get object sizes.
-		boltObjSizes = append(boltObjSizes, *output.ContentLength)
-		// close response stream.
+	// calc latency
+	result.latency = time.Since(result.start)
+	if err != nil {
 		output.Body.Close()
+		return result, err
 	}
 
-	// calc bolt perf stats.
-	boltGetObjPtPerfStats := p.computePerfStats(boltGetObjTimes, nil, boltObjSizes)
-
-	var boltGetObjPtStatName string
-	if p.requestType == "GET_OBJECT_PASSTHROUGH_TTFB" {
-		boltGetObjPtStatName = "bolt_get_obj_pt_ttfb_perf_stats"
-	} else {
-		boltGetObjPtStatName = "bolt_get_obj_pt_perf_stats"
+	// count object.
+	if (output.ContentEncoding != nil &&
+		len(*output.ContentEncoding) > 0 && *output.ContentEncoding == "gzip") ||
+		strings.HasSuffix(key, ".gz") {
+		result.compressed = true
 	}
 
-	boltCount := &ObjectCount{
-		Compressed:   fmt.Sprintf("%d", boltCmpObjCount),
-		Uncompressed: fmt.Sprintf("%d", boltUnCmpObjCount),
+	// get object sizes.
+	result.bytes = *output.ContentLength
+	// close response stream.
+	output.Body.Close()
+	return result, nil
+}
+
+// getObjectStats computes the perf stats of a get object run, and the count of compressed / uncompressed
+// objects.
+func (p *BoltS3Perf) getObjectStats(run *targetRun, ttfb bool) (*NumericPerfStats, *NumericObjectCount) {
+
+	cmpObjCount := run.results.compressed
+	unCmpObjCount := run.results.count - run.results.compressed
+
+	// calc perf stats.
+	getObjPerfStats := p.runStats(run, false, true)
+	if ttfb {
+		// only the first byte of each object is transferred.
+		getObjPerfStats.BytesThroughput = nil
+		getObjPerfStats.SizeBuckets = nil
 	}
 
-	getObjPtPerfRespMap := make(map[string]interface{})
-	getObjPtPerfRespMap[boltGetObjPtStatName] = boltGetObjPtPerfStats
-	getObjPtPerfRespMap["boltCount"] = boltCount
-	return getObjPtPerfRespMap, nil
+	count := &NumericObjectCount{
+		Compressed:   cmpObjCount,
+		Uncompressed: unCmpObjCount,
+	}
+	return getObjPerfStats, count
 }
 
 // allPerf measures PUT,GET,DELETE,List Objects performance (latency, throughput) of Bolt / S3.
@@ -542,8 +1068,11 @@ func (p *BoltS3Perf) allPerf(bucket string) (map[string]interface{}, error) {
 		return nil, err
 	}
 
-	// Get the list of objects before get object perf test.
-	err = p.listObjectsV2(bucket)
+	// Get the list of objects before get object perf test, and restore the generated key names afterwards.
+	generatedKeys := p.keys
+	defer func() { p.keys = generatedKeys }()
+	p.keys = nil
+	err = p.loadKeys(bucket)
 	if err != nil {
 		return nil, err
 	}
@@ -570,114 +1099,126 @@ func (p *BoltS3Perf) mergePerfStats(perfStats ...map[string]interface{}) map[str
 	return mergedPerfStats
 }
 
-// listObjectsV2 returns a list of `numKeys` objects from the given bucket in S3.
-func (p *BoltS3Perf) listObjectsV2(bucket string) error {
-	listObjsV2Input := &s3.ListObjectsV2Input{
-		Bucket: aws.String(bucket),
-	}
-
-	resp, err := p.s3Svc.ListObjectsV2(listObjsV2Input)
-	if err != nil {
-		return err
-	}
-
-	for _, item := range resp.Contents {
-		p.keys = append(p.keys, *item.Key)
-	}
-	return nil
-}
-
-// generateKeyNames generates object names to be used in PUT, DELETE Object Perf.
+// generateKeyNames generates object names under the run prefix to be used in PUT, DELETE Object Perf.
 func (p *BoltS3Perf) generateKeyNames(numObjects int)  {
 	for i := 0; i < numObjects; i++ {
-		key := "bolt-s3-perf" + strconv.Itoa(i)
+		key := p.runPrefix + "key" + strconv.Itoa(i)
 		p.keys = append(p.keys, key)
 	}
 }
 
-// generate creates a random string of certain length.
-func (p *BoltS3Perf) generate(objLength int) string {
-	var letters = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789")
+// computePerfStats computes the latency, throughput and object size statistics of the recorded operations.
+// If the throughput of each operation (objects/ms) is not computed, the overall throughput is computed from the
+// latencies.
+func (p *BoltS3Perf) computePerfStats(results *recorder, opTp bool, objSizes bool) *NumericPerfStats {
 
-	s := make([]rune, objLength)
-	for i := range s {
-		s[i] = letters[rand.Intn(len(letters))]
+	perfStats := &NumericPerfStats{}
+	if p.errorBudget != nil {
+		perfStats.Errors = results.errorStats()
+	}
+	if results.count == 0 {
+		return perfStats
 	}
-	return string(s)
-}
-
-// computePerfStats compute Performance Statistics
-func (p *BoltS3Perf) computePerfStats(opTimes []int64, opTp []float64, objSizes []int64) *PerfStats {
-
-	perfStats := &PerfStats{}
 
-	// calc op latency perf
-	sort.SliceStable(opTimes, func(i, j int) bool {
-		return opTimes[i] < opTimes[j]
-	})
+	// calc op latency perf (ns to ms).
+	perfStats.Latency = histogramSummary(results.latency, float64(time.Millisecond)).numericPerfStat("ms")
+	perfStats.Latency.Histogram = histogramBuckets(results.latency, float64(time.Millisecond), latencyBucketBounds)
+	if encoded, err := results.latency.Encode(); err == nil {
+		perfStats.LatencyHdrHistogram = encoded
+	}
 
-	var opTimesSum int64 = 0
-	for _, opTime := range opTimes {
-		opTimesSum += opTime
+	// calc op latency perf from the intended start of each op, corrected for coordinated omission.
+	if results.correctedLatency.TotalCount() > 0 {
+		correctedSummary := histogramSummary(results.correctedLatency, float64(time.Millisecond))
+		perfStats.CorrectedLatency = correctedSummary.numericPerfStat("ms")
+		perfStats.CorrectedLatency.Histogram = histogramBuckets(results.correctedLatency, float64(time.Millisecond),
+			latencyBucketBounds)
+		if encoded, err := results.correctedLatency.Encode(); err == nil {
+			perfStats.CorrectedLatencyHdrHistogram = encoded
+		}
 	}
 
-	opAvgTime := float64(opTimesSum) / float64(len(opTimes))
-	opTimeP50 := opTimes[len(opTimes) / 2]
-	opTimeP90 := opTimes[int(float64(len(opTimes)) * 0.9)]
+	// calc latency perf of each phase of the requests (ns to ms).
+	perfStats.Phases = phaseStats(results)
 
-	latencyPerfStats := &PerfStat{
-		Average: fmt.Sprintf("%.2f ms", opAvgTime),
-		P50:     fmt.Sprintf("%d ms", opTimeP50),
-		P90:     fmt.Sprintf("%d ms", opTimeP90),
+	// calc latency perf of the parts of multipart uploads and parallel downloads (ns to ms), and the end-to-end
+	// throughput of each transfer (bytes/s to MB/s).
+	if results.partLatency.TotalCount() > 0 {
+		perfStats.PartLatency = histogramSummary(results.partLatency, float64(time.Millisecond)).numericPerfStat("ms")
+		perfStats.TransferThroughput = histogramSummary(results.bytesTp, 1e6).numericPerfStat("MB/s")
 	}
-	perfStats.Latency = latencyPerfStats
 
-	// calc op throughput perf.
-	var opAvgTp,opTpP50, opTpP90 float64
-	if opTp != nil {
-		sort.Float64s(opTp)
+	// calc op throughput perf (objects/s to objects/ms).
+	if opTp && results.objectsTp.TotalCount() > 0 {
+		perfStats.Throughput = histogramSummary(results.objectsTp, 1000).numericPerfStat("objects/ms")
+	} else if results.totalLatency > 0 {
+		tp := float64(results.count) / durationMs(results.totalLatency)
+		perfStats.ThroughputT = &Metric{Value: tp, Unit: "objects/ms"}
+	}
 
-		var opTpSum = 0.0
-		for _, tp := range opTp {
-			opTpSum += tp
+	// calc obj size metrics, and the throughput (MB/s) of each size bucket.
+	if objSizes {
+		perfStats.ObjectSize = histogramSummary(results.bytes, 1).numericPerfStat("bytes")
+		for b, totals := range results.sizeBuckets {
+			if totals.count == 0 || totals.latency <= 0 {
+				continue
+			}
+			bucket := SizeBucketStats{
+				Count:      totals.count,
+				Bytes:      totals.bytes,
+				Throughput: &Metric{Value: float64(totals.bytes) / 1e6 / totals.latency.Seconds(), Unit: "MB/s"},
+			}
+			if b < len(sizeBucketBounds) {
+				bucket.UpperBound = &sizeBucketBounds[b]
+			}
+			perfStats.SizeBuckets = append(perfStats.SizeBuckets, bucket)
 		}
+	}
+	return perfStats
+}
 
-		opAvgTp = opTpSum / float64(len(opTp))
-		opTpP50 = opTp[len(opTp) / 2]
-		opTpP90 = opTp[int(float64(len(opTp)) * 0.9)]
+// computeThroughput computes the aggregate throughput (ops/s, bytes/s) of the operations that completed in the
+// given wall-clock time, at the current concurrency level.
+func (p *BoltS3Perf) computeThroughput(perfStats *NumericPerfStats, results *recorder, elapsed time.Duration) {
 
-		tpPerfStats := &PerfStat{
-			Average: fmt.Sprintf("%.2f objects/ms", opAvgTp),
-			P50:     fmt.Sprintf("%.2f objects/ms", opTpP50),
-			P90:     fmt.Sprintf("%.2f objects/ms", opTpP90),
-		}
-		perfStats.Throughput = tpPerfStats
-	} else {
-		tp := float64(len(opTimes)) / float64(opTimesSum)
-		perfStats.ThroughputT = fmt.Sprintf("%.2f objects/ms", tp)
-	}
+	numBytes := results.totalBytes
 
-	// calc obj size metrics.
-	if objSizes != nil {
-		sort.SliceStable(objSizes, func(i, j int) bool {
-			return objSizes[i] < objSizes[j]
-		})
+	perfStats.Concurrency = p.concurrency
+	if p.rate > 0 {
+		perfStats.TargetRate = &Metric{Value: p.rate, Unit: "requests/s"}
+	}
+	if elapsed <= 0 {
+		return
+	}
+	perfStats.Elapsed = &Metric{Value: durationMs(elapsed), Unit: "ms"}
+	perfStats.OpsThroughput = &Metric{Value: float64(results.count) / elapsed.Seconds(), Unit: "ops/s"}
+	if numBytes > 0 {
+		perfStats.BytesThroughput = &Metric{Value: float64(numBytes) / elapsed.Seconds(), Unit: "bytes/s"}
+	}
+}
 
-		var objSizesSum int64 = 0
-		for _, objSize := range objSizes {
-			objSizesSum += objSize
-		}
+// runStats computes the perf stats of a run, with the throughput (objects/ms) of each op if opTp is set and the
+// object sizes if objSizes is set, and its aggregate throughput.
+func (p *BoltS3Perf) runStats(run *targetRun, opTp bool, objSizes bool) *NumericPerfStats {
+	perfStats := p.computePerfStats(run.results, opTp, objSizes)
+	p.computeThroughput(perfStats, run.results, run.elapsed)
+	return perfStats
+}
 
-		objAvgSize := float64(objSizesSum) / float64(len(objSizes))
-		objSizeP50 := objSizes[len(objSizes) / 2]
-		objSizeP90 := objSizes[int(float64(len(objSizes)) * 0.9)]
+// targets returns the clients of the targets of a perf test: S3 and Bolt.
+func (p *BoltS3Perf) targets() []*s3.S3 {
+	return []*s3.S3{p.s3Svc, p.boltSvc}
+}
 
-		objSizesPerfStats := &PerfStat{
-			Average: fmt.Sprintf("%.2f bytes", objAvgSize),
-			P50:     fmt.Sprintf("%d bytes", objSizeP50),
-			P90:     fmt.Sprintf("%d bytes", objSizeP90),
-		}
-		perfStats.ObjectSize = objSizesPerfStats
+// numOps returns the no. of operations of a perf test that uses each key numIter times.
+func (p *BoltS3Perf) numOps() int {
+	if p.numIter == 0 {
+		return len(p.keys)
 	}
-	return perfStats
+	return len(p.keys) * p.numIter
+}
+
+// durationMs converts the duration to fractional milliseconds.
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
 }
\ No newline at end of file
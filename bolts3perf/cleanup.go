@@ -0,0 +1,108 @@
+package bolts3perf
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"sync"
+	"time"
+)
+
+// ErrRunTimeout is returned when a perf run is stopped before the deadline of its context, to leave time to
+// clean up the objects of the run.
+var ErrRunTimeout = errors.New("perf run timed out")
+
+// runKeyPrefix is the prefix of the keys of the objects created by perf runs. Each run creates its objects
+// under runKeyPrefix/<run id>/.
+const runKeyPrefix = "bolt-s3-perf"
+
+// cleanupConcurrency is the no. of concurrent delete requests of the cleanup of a run.
+const cleanupConcurrency = 32
+
+// CleanupSummary describes the objects deleted by the cleanup of a perf run.
+type CleanupSummary struct {
+	Prefix string `json:"prefix"`
+	S3Deleted int64 `json:"s3Deleted"`
+	BoltDeleted int64 `json:"boltDeleted"`
+	// no. of objects that could not be deleted, and the first error.
+	Failed int64 `json:"failed"`
+	Error string `json:"error,omitempty"`
+}
+
+// newRunID returns a unique id of a perf run: the current time followed by random hex digits, so that
+// concurrent runs (e.g. concurrent Lambda functions) never share keys.
+func newRunID() (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s-%s", time.Now().UTC().Format("20060102T150405Z"), hex.EncodeToString(b)), nil
+}
+
+// runPerfTestsAndCleanup performs the Perf Test at each concurrency level and, unless objects are kept, deletes
+// all objects created under the run prefix from S3 and Bolt once the tests are complete, even if they failed.
+func (p *BoltS3Perf) runPerfTestsAndCleanup(bucket string,
+	concurrencyLevels []int) (perfStats map[string]interface{}, cleanup *CleanupSummary, err error) {
+
+	if len(p.runPrefix) > 0 && !p.keepObjects {
+		defer func() {
+			cleanup = p.cleanup(bucket)
+		}()
+	}
+	perfStats, err = p.runPerfTests(bucket, concurrencyLevels)
+	return perfStats, cleanup, err
+}
+
+// cleanup lists the objects under the run prefix in S3 and Bolt, and deletes them.
+func (p *BoltS3Perf) cleanup(bucket string) *CleanupSummary {
+
+	summary := &CleanupSummary{Prefix: p.runPrefix}
+	s3Deleted, s3Failed, s3Err := p.deletePrefix(p.s3Svc, bucket, p.runPrefix)
+	boltDeleted, boltFailed, boltErr := p.deletePrefix(p.boltSvc, bucket, p.runPrefix)
+	summary.S3Deleted = s3Deleted
+	summary.BoltDeleted = boltDeleted
+	summary.Failed = s3Failed + boltFailed
+	if s3Err != nil {
+		summary.Error = fmt.Sprintf("s3: %v", s3Err)
+	} else if boltErr != nil {
+		summary.Error = fmt.Sprintf("bolt: %v", boltErr)
+	}
+	return summary
+}
+
+// deletePrefix deletes all objects under the prefix from the given Bolt / S3 client, and returns the no. of
+// objects deleted, the no. of objects that could not be deleted and the first error.
+func (p *BoltS3Perf) deletePrefix(svc *s3.S3, bucket string, prefix string) (int64, int64, error) {
+
+	var keys []string
+	err := svc.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, item := range page.Contents {
+			keys = append(keys, *item.Key)
+		}
+		return true
+	})
+
+	var mu sync.Mutex
+	var deleted, failed int64
+	deleteErr := forEachKey(keys, cleanupConcurrency, func(_ int, key string) error {
+		_, err := svc.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			failed++
+		} else {
+			deleted++
+		}
+		return err
+	})
+	if err == nil {
+		err = deleteErr
+	}
+	return deleted, failed, err
+}
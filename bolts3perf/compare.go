@@ -0,0 +1,319 @@
+package bolts3perf
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// Verdicts of the comparison of Bolt with S3.
+const (
+	verdictFaster = "faster"
+	verdictSlower = "slower"
+	verdictNotDistinguishable = "not distinguishable"
+)
+
+const (
+	// confidence level of the confidence intervals, and 1 - the significance level of the Mann-Whitney U test.
+	comparisonConfidence = 0.95
+	// no. of bootstrap resamples of each confidence interval.
+	bootstrapResamples = 1000
+	// min no. of requests to each target for the normal approximation of the Mann-Whitney U test.
+	minComparisonSamples = 10
+)
+
+// comparedPercentiles are the latency percentiles compared between Bolt and S3.
+var comparedPercentiles = []struct {
+	name string
+	percentile float64
+}{
+	{"p50", 50},
+	{"p90", 90},
+	{"p95", 95},
+	{"p99", 99},
+	{"p99.9", 99.9},
+}
+
+// NumericComparison compares the latency of the requests of a test to Bolt with the latency of the requests to
+// S3: the ratio and difference of each percentile, with their bootstrap confidence intervals, and the
+// Mann-Whitney U test of the two sets of latencies. Verdict is whether Bolt is faster, slower or not
+// distinguishable from S3 in the run. It is the numeric counterpart of Comparison.
+type NumericComparison struct {
+	S3Count int64 `json:"s3Count"`
+	BoltCount int64 `json:"boltCount"`
+	Confidence float64 `json:"confidence"`
+	Percentiles []NumericPercentileComparison `json:"percentiles,omitempty"`
+	MannWhitneyU *MannWhitneyU `json:"mannWhitneyU,omitempty"`
+	Verdict string `json:"verdict"`
+	Summary string `json:"summary"`
+}
+
+// NumericPercentileComparison compares a latency percentile of Bolt with that of S3: the ratio (Bolt / S3) and
+// the difference (Bolt - S3, in ms).
+type NumericPercentileComparison struct {
+	Percentile string `json:"percentile"`
+	S3 *Metric `json:"s3"`
+	Bolt *Metric `json:"bolt"`
+	Ratio *Estimate `json:"ratio,omitempty"`
+	Difference *Estimate `json:"difference"`
+}
+
+// Estimate is an estimated value and its confidence interval [Low, High].
+type Estimate struct {
+	Value float64 `json:"value"`
+	Low float64 `json:"low"`
+	High float64 `json:"high"`
+	Unit string `json:"unit,omitempty"`
+}
+
+// MannWhitneyU is the result of the Mann-Whitney U test of the latencies of Bolt and S3: the U statistic of
+// Bolt (the no. of pairs of a Bolt and an S3 request in which the Bolt request is faster, ties counting half),
+// its z-score (normal approximation, corrected for ties and continuity), the two-sided p-value, and the
+// probability that a Bolt request is faster than an S3 request (U / (no. of pairs)).
+type MannWhitneyU struct {
+	U float64 `json:"u"`
+	Z float64 `json:"z"`
+	PValue float64 `json:"pValue"`
+	ProbBoltFaster float64 `json:"probBoltFaster"`
+}
+
+// compareRuns compares the latency of the requests of the Bolt run with that of the S3 run.
+func compareRuns(s3Run *targetRun, boltRun *targetRun) *NumericComparison {
+	return compareLatency(s3Run.results.latency, boltRun.results.latency)
+}
+
+// compareLatency compares the latencies (ns) recorded in the Bolt histogram with those recorded in the S3
+// histogram.
+func compareLatency(s3Latency *Histogram, boltLatency *Histogram) *NumericComparison {
+	return compareLatencyRand(s3Latency, boltLatency, rand.New(rand.NewSource(time.Now().UnixNano())))
+}
+
+// compareLatencyRand compares the latencies as compareLatency does, drawing the bootstrap resamples with rng.
+func compareLatencyRand(s3Latency *Histogram, boltLatency *Histogram, rng *rand.Rand) *NumericComparison {
+
+	comparison := &NumericComparison{
+		S3Count:    s3Latency.TotalCount(),
+		BoltCount:  boltLatency.TotalCount(),
+		Confidence: comparisonConfidence,
+		Verdict:    verdictNotDistinguishable,
+	}
+	if comparison.S3Count == 0 || comparison.BoltCount == 0 {
+		comparison.Summary = fmt.Sprintf("Bolt and S3 are not distinguishable: no successful requests to %s.",
+			noRequestsTarget(comparison))
+		return comparison
+	}
+
+	// compare the percentiles, with bootstrap confidence intervals of their ratio and difference (ns to ms).
+	s3Ranks, boltRanks := newRankTable(s3Latency), newRankTable(boltLatency)
+	for _, p := range comparedPercentiles {
+		s3Value := float64(s3Latency.ValueAtPercentile(p.percentile)) / float64(time.Millisecond)
+		boltValue := float64(boltLatency.ValueAtPercentile(p.percentile)) / float64(time.Millisecond)
+		ratios := make([]float64, 0, bootstrapResamples)
+		differences := make([]float64, bootstrapResamples)
+		for b := range differences {
+			s3Resampled := float64(s3Ranks.resampledPercentile(rng, p.percentile)) / float64(time.Millisecond)
+			boltResampled := float64(boltRanks.resampledPercentile(rng, p.percentile)) / float64(time.Millisecond)
+			differences[b] = boltResampled - s3Resampled
+			if s3Resampled > 0 {
+				ratios = append(ratios, boltResampled / s3Resampled)
+			}
+		}
+
+		percentileComparison := NumericPercentileComparison{
+			Percentile: p.name,
+			S3:         &Metric{Value: s3Value, Unit: "ms"},
+			Bolt:       &Metric{Value: boltValue, Unit: "ms"},
+			Difference: confidenceInterval(boltValue - s3Value, differences, "ms"),
+		}
+		if s3Value > 0 && len(ratios) > 0 {
+			percentileComparison.Ratio = confidenceInterval(boltValue / s3Value, ratios, "")
+		}
+		comparison.Percentiles = append(comparison.Percentiles, percentileComparison)
+	}
+
+	if comparison.S3Count < minComparisonSamples || comparison.BoltCount < minComparisonSamples {
+		comparison.Summary = fmt.Sprintf("Bolt and S3 are not distinguishable: too few requests (%d to Bolt, %d "+
+			"to S3, at least %d needed).", comparison.BoltCount, comparison.S3Count, minComparisonSamples)
+		return comparison
+	}
+
+	// test whether the latencies of Bolt and S3 follow the same distribution.
+	comparison.MannWhitneyU = mannWhitneyU(s3Latency, boltLatency)
+	if comparison.MannWhitneyU == nil {
+		comparison.Summary = "Bolt and S3 are not distinguishable: their latencies cannot be compared."
+		return comparison
+	}
+	if comparison.MannWhitneyU.PValue < 1 - comparisonConfidence {
+		if comparison.MannWhitneyU.ProbBoltFaster > 0.5 {
+			comparison.Verdict = verdictFaster
+		} else {
+			comparison.Verdict = verdictSlower
+		}
+	}
+	comparison.Summary = comparison.summary()
+	return comparison
+}
+
+// noRequestsTarget returns the targets without successful requests.
+func noRequestsTarget(c *NumericComparison) string {
+	switch {
+	case c.S3Count == 0 && c.BoltCount == 0:
+		return "Bolt and S3"
+	case c.S3Count == 0:
+		return "S3"
+	default:
+		return "Bolt"
+	}
+}
+
+// summary states the verdict of the comparison, with the p50 latencies and the result of the Mann-Whitney U
+// test, e.g. "Bolt is faster than S3: p50 latency 12.345 ms vs 20.100 ms (0.61x, 95% CI 0.58x - 0.65x),
+// Mann-Whitney U p-value 0.0001, Bolt faster in 72.0% of request pairs."
+func (c *NumericComparison) summary() string {
+
+	var verdict string
+	switch c.Verdict {
+	case verdictFaster:
+		verdict = "Bolt is faster than S3"
+	case verdictSlower:
+		verdict = "Bolt is slower than S3"
+	default:
+		verdict = "Bolt and S3 are not distinguishable"
+	}
+
+	p50 := c.Percentiles[0]
+	ratio := ""
+	if p50.Ratio != nil {
+		ratio = fmt.Sprintf(" (%.2fx, %g%% CI %.2fx - %.2fx)", p50.Ratio.Value, c.Confidence * 100, p50.Ratio.Low,
+			p50.Ratio.High)
+	}
+	return fmt.Sprintf("%s: p50 latency %.3f ms vs %.3f ms%s, Mann-Whitney U p-value %.4g, Bolt faster in %.1f%% "+
+		"of request pairs.", verdict, p50.Bolt.Value, p50.S3.Value, ratio, c.MannWhitneyU.PValue,
+		c.MannWhitneyU.ProbBoltFaster * 100)
+}
+
+// confidenceInterval returns the estimate of the value, with the bootstrap percentile confidence interval of
+// its resampled values.
+func confidenceInterval(value float64, resampled []float64, unit string) *Estimate {
+	sort.Float64s(resampled)
+	tail := (1 - comparisonConfidence) / 2
+	low := int(math.Floor(tail * float64(len(resampled))))
+	high := int(math.Ceil((1 - tail) * float64(len(resampled)))) - 1
+	if high < low {
+		high = low
+	}
+	return &Estimate{Value: value, Low: resampled[low], High: resampled[high], Unit: unit}
+}
+
+// mannWhitneyU runs the Mann-Whitney U test of the values recorded in the two histograms, which must have the
+// same layout. Values that are equivalent within the precision of the histograms are ties.
+func mannWhitneyU(s3Latency *Histogram, boltLatency *Histogram) *MannWhitneyU {
+
+	if !s3Latency.sameLayout(boltLatency) {
+		return nil
+	}
+
+	n1 := float64(boltLatency.TotalCount())
+	n2 := float64(s3Latency.TotalCount())
+	n := n1 + n2
+
+	// count the S3 values above each Bolt value, and the ties.
+	var u, ties float64
+	s3Above := n2
+	for i := range boltLatency.counts {
+		boltCount, s3Count := float64(boltLatency.counts[i]), float64(s3Latency.counts[i])
+		s3Above -= s3Count
+		u += boltCount * (s3Above + s3Count / 2)
+		t := boltCount + s3Count
+		ties += t * t * t - t
+	}
+
+	mean := n1 * n2 / 2
+	variance := n1 * n2 / 12 * ((n + 1) - ties / (n * (n - 1)))
+	result := &MannWhitneyU{U: u, PValue: 1, ProbBoltFaster: u / (n1 * n2)}
+	if variance > 0 {
+		// continuity correction.
+		diff := math.Max(math.Abs(u - mean) - 0.5, 0)
+		result.Z = math.Copysign(diff / math.Sqrt(variance), u - mean)
+		result.PValue = math.Erfc(math.Abs(result.Z) / math.Sqrt2)
+	}
+	return result
+}
+
+// rankTable holds the values recorded in a histogram in increasing order, with the cumulative no. of values,
+// to look up the value of each rank.
+type rankTable struct {
+	values []int64
+	cumCounts []int64
+}
+
+func newRankTable(h *Histogram) *rankTable {
+	t := &rankTable{}
+	var total int64 = 0
+	for i, count := range h.counts {
+		if count > 0 {
+			total += count
+			t.values = append(t.values, h.highestEquivalentValue(h.valueFromIndex(i)))
+			t.cumCounts = append(t.cumCounts, total)
+		}
+	}
+	return t
+}
+
+// valueAtRank returns the value of the given rank (from 1).
+func (t *rankTable) valueAtRank(rank int64) int64 {
+	i := sort.Search(len(t.cumCounts), func(i int) bool { return t.cumCounts[i] >= rank })
+	if i == len(t.values) {
+		i--
+	}
+	return t.values[i]
+}
+
+// resampledPercentile returns the percentile of a bootstrap resample (n values drawn with replacement) of the
+// n recorded values. The percentile is the value of rank k = ceil(percentile / 100 * n) of the resample, whose
+// quantile in the recorded values follows a Beta(k, n - k + 1) distribution, so that the percentile can be
+// drawn directly instead of drawing the n values of the resample.
+func (t *rankTable) resampledPercentile(rng *rand.Rand, percentile float64) int64 {
+	n := t.cumCounts[len(t.cumCounts) - 1]
+	k := int64(math.Ceil(percentile / 100 * float64(n)))
+	if k < 1 {
+		k = 1
+	}
+	if k > n {
+		k = n
+	}
+	q := betaSample(rng, float64(k), float64(n - k + 1))
+	rank := int64(math.Ceil(q * float64(n)))
+	if rank < 1 {
+		rank = 1
+	}
+	return t.valueAtRank(rank)
+}
+
+// betaSample draws a value from the Beta(a, b) distribution (a, b >= 1).
+func betaSample(rng *rand.Rand, a float64, b float64) float64 {
+	x := gammaSample(rng, a)
+	y := gammaSample(rng, b)
+	return x / (x + y)
+}
+
+// gammaSample draws a value from the Gamma(shape, 1) distribution (shape >= 1), using the method of Marsaglia
+// and Tsang.
+func gammaSample(rng *rand.Rand, shape float64) float64 {
+	d := shape - 1.0 / 3
+	c := 1 / math.Sqrt(9 * d)
+	for {
+		x := rng.NormFloat64()
+		v := 1 + c * x
+		if v <= 0 {
+			continue
+		}
+		v = v * v * v
+		u := rng.Float64()
+		if u < 1 - 0.0331 * x * x * x * x || math.Log(u) < 0.5 * x * x + d * (1 - v + math.Log(v)) {
+			return d * v
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package bolts3perf
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// newLatencyHistogram returns a latency histogram recording the latencies, in ms.
+func newLatencyHistogram(latenciesMs []int64) *Histogram {
+	values := make([]int64, len(latenciesMs))
+	for i, ms := range latenciesMs {
+		values[i] = ms * int64(time.Millisecond)
+	}
+	return newTestHistogram(values)
+}
+
+func TestMannWhitneyUTies(t *testing.T) {
+	// expected values computed from the mid-ranks of the pooled values, with the tie and continuity corrections.
+	tests := []struct {
+		name string
+		bolt []int64
+		s3 []int64
+		u float64
+		z float64
+		pValue float64
+	}{
+		{
+			name:   "small tied samples",
+			bolt:   []int64{1, 2, 2},
+			s3:     []int64{2, 3, 3, 4},
+			u:      11,
+			z:      1.667156790678634,
+			pValue: 0.09548323209754739,
+		},
+		{
+			name:   "tied samples",
+			bolt:   []int64{1, 1, 2, 2, 2, 3},
+			s3:     []int64{2, 2, 3, 3, 3, 4, 4},
+			u:      35.5,
+			z:      2.0941686103737442,
+			pValue: 0.03624496292288837,
+		},
+		{
+			name:   "all tied",
+			bolt:   []int64{5, 5, 5},
+			s3:     []int64{5, 5},
+			u:      3,
+			z:      0,
+			pValue: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := mannWhitneyU(newTestHistogram(tt.s3), newTestHistogram(tt.bolt))
+			if result == nil {
+				t.Fatal("mannWhitneyU() = nil")
+			}
+			if result.U != tt.u {
+				t.Errorf("U = %g, want %g", result.U, tt.u)
+			}
+			if math.Abs(result.Z - tt.z) > 1e-9 {
+				t.Errorf("Z = %g, want %g", result.Z, tt.z)
+			}
+			if math.Abs(result.PValue - tt.pValue) > 1e-9 {
+				t.Errorf("PValue = %g, want %g", result.PValue, tt.pValue)
+			}
+			if want := tt.u / float64(len(tt.bolt) * len(tt.s3)); result.ProbBoltFaster != want {
+				t.Errorf("ProbBoltFaster = %g, want %g", result.ProbBoltFaster, want)
+			}
+		})
+	}
+}
+
+func TestCompareLatency(t *testing.T) {
+	tests := []struct {
+		name string
+		bolt []int64
+		s3 []int64
+		verdict string
+		minPValue float64
+		maxPValue float64
+		// whether the confidence interval of the p50 ratio lies below 1, contains 1 or lies above 1.
+		ratio int
+	}{
+		{
+			name:      "identical samples",
+			bolt:      sequence(10, 1, 200),
+			s3:        sequence(10, 1, 200),
+			verdict:   verdictNotDistinguishable,
+			minPValue: 0.99,
+			maxPValue: 1,
+			ratio:     0,
+		},
+		{
+			name:      "bolt faster",
+			bolt:      sequence(10, 1, 100),
+			s3:        sequence(200, 1, 100),
+			verdict:   verdictFaster,
+			minPValue: 0,
+			maxPValue: 1e-10,
+			ratio:     -1,
+		},
+		{
+			name:      "bolt slower",
+			bolt:      sequence(200, 1, 100),
+			s3:        sequence(10, 1, 100),
+			verdict:   verdictSlower,
+			minPValue: 0,
+			maxPValue: 1e-10,
+			ratio:     1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			comparison := compareLatencyRand(newLatencyHistogram(tt.s3), newLatencyHistogram(tt.bolt),
+				rand.New(rand.NewSource(1)))
+			if comparison.Verdict != tt.verdict {
+				t.Errorf("Verdict = %q, want %q", comparison.Verdict, tt.verdict)
+			}
+			if comparison.MannWhitneyU == nil {
+				t.Fatal("MannWhitneyU = nil")
+			}
+			if p := comparison.MannWhitneyU.PValue; p < tt.minPValue || p > tt.maxPValue {
+				t.Errorf("PValue = %g, want in [%g, %g]", p, tt.minPValue, tt.maxPValue)
+			}
+			if len(comparison.Percentiles) != len(comparedPercentiles) {
+				t.Fatalf("%d percentiles, want %d", len(comparison.Percentiles), len(comparedPercentiles))
+			}
+
+			for _, p := range comparison.Percentiles {
+				for _, e := range []*Estimate{p.Ratio, p.Difference} {
+					if e.Low > e.Value || e.Value > e.High {
+						t.Errorf("%s: estimate %g outside its confidence interval [%g, %g]", p.Percentile, e.Value,
+							e.Low, e.High)
+					}
+				}
+			}
+			ratio := comparison.Percentiles[0].Ratio
+			switch {
+			case tt.ratio < 0 && ratio.High >= 1, tt.ratio > 0 && ratio.Low <= 1,
+				tt.ratio == 0 && (ratio.Low > 1 || ratio.High < 1):
+				t.Errorf("p50 ratio confidence interval [%g, %g]", ratio.Low, ratio.High)
+			}
+		})
+	}
+}
+
+func TestCompareLatencyTooFewSamples(t *testing.T) {
+	tests := []struct {
+		name string
+		bolt []int64
+		s3 []int64
+	}{
+		{name: "no bolt requests", bolt: nil, s3: sequence(10, 1, 100)},
+		{name: "no requests", bolt: nil, s3: nil},
+		{name: "too few requests", bolt: sequence(10, 1, minComparisonSamples - 1), s3: sequence(200, 1, 100)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			comparison := compareLatencyRand(newLatencyHistogram(tt.s3), newLatencyHistogram(tt.bolt),
+				rand.New(rand.NewSource(1)))
+			if comparison.Verdict != verdictNotDistinguishable {
+				t.Errorf("Verdict = %q, want %q", comparison.Verdict, verdictNotDistinguishable)
+			}
+			if comparison.MannWhitneyU != nil {
+				t.Errorf("MannWhitneyU = %+v, want nil", comparison.MannWhitneyU)
+			}
+			if len(comparison.Summary) == 0 {
+				t.Error("empty Summary")
+			}
+		})
+	}
+}
+
+func TestResampledPercentile(t *testing.T) {
+	// The median of a resample of n uniform values has a standard deviation of about n / (2 * sqrt(n)).
+	table := newRankTable(newTestHistogram(sequence(1, 1, 1000)))
+	rng := rand.New(rand.NewSource(1))
+	const resamples = 5000
+	var sum, sumSquares float64
+	for i := 0; i < resamples; i++ {
+		v := float64(table.resampledPercentile(rng, 50))
+		sum += v
+		sumSquares += v * v
+	}
+	mean := sum / resamples
+	stdDev := math.Sqrt(sumSquares / resamples - mean * mean)
+	if math.Abs(mean - 500) > 2 {
+		t.Errorf("mean of the resampled medians = %g, want 500", mean)
+	}
+	if want := 1000 / (2 * math.Sqrt(1000)); math.Abs(stdDev - want) > want * 0.1 {
+		t.Errorf("standard deviation of the resampled medians = %g, want %g", stdDev, want)
+	}
+}
+
+func TestBetaSample(t *testing.T) {
+	tests := []struct {
+		a float64
+		b float64
+	}{
+		{1, 1},
+		{2, 5},
+		{500, 501},
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	for _, tt := range tests {
+		const n = 20000
+		var sum float64
+		for i := 0; i < n; i++ {
+			x := betaSample(rng, tt.a, tt.b)
+			if x < 0 || x > 1 {
+				t.Fatalf("betaSample(%g, %g) = %g, want in [0, 1]", tt.a, tt.b, x)
+			}
+			sum += x
+		}
+		if mean, want := sum / n, tt.a / (tt.a + tt.b); math.Abs(mean - want) > 0.01 {
+			t.Errorf("mean of betaSample(%g, %g) = %g, want %g", tt.a, tt.b, mean, want)
+		}
+	}
+}
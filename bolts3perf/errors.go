@@ -0,0 +1,182 @@
+package bolts3perf
+
+import (
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrErrorBudgetExceeded is returned when more requests of an error-tolerant perf run fail than its error
+// budget allows.
+var ErrErrorBudgetExceeded = errors.New("error budget exceeded")
+
+// minErrorBudgetSamples is the no. of requests from which a run is stopped as soon as its error rate exceeds
+// the budget, so that the first few requests do not decide the run. The error rate of the whole run is checked
+// once it is complete.
+const minErrorBudgetSamples = 100
+
+// errorBudget is the no. of failed requests (or the percentage of requests) that an error-tolerant perf run
+// tolerates before it fails.
+type errorBudget struct {
+	// max no. of failed requests, if the budget is not a rate.
+	count int64
+	// max fraction of failed requests, if the budget is a rate.
+	rate float64
+	isRate bool
+}
+
+// parseErrorBudget parses an error budget: a no. of failed requests (e.g. "50") or a percentage of the
+// requests (e.g. "5%").
+func parseErrorBudget(s string) (*errorBudget, error) {
+	value := strings.TrimSpace(s)
+	if strings.HasSuffix(value, "%") {
+		percent, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(value, "%")), 64)
+		if err != nil || !(percent >= 0 && percent <= 100) {
+			return nil, fmt.Errorf("invalid errorBudget: %s", s)
+		}
+		return &errorBudget{rate: percent / 100, isRate: true}, nil
+	}
+	count, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || count < 0 {
+		return nil, fmt.Errorf("invalid errorBudget: %s", s)
+	}
+	return &errorBudget{count: count}, nil
+}
+
+func (b *errorBudget) String() string {
+	if b.isRate {
+		return fmt.Sprintf("%g%%", b.rate * 100)
+	}
+	return strconv.FormatInt(b.count, 10)
+}
+
+// check returns ErrErrorBudgetExceeded if the failed requests exceed the budget. Unless the run is complete, an
+// error rate is only checked from minErrorBudgetSamples requests.
+func (b *errorBudget) check(results *recorder, complete bool) error {
+	failed, total := results.errorCounts()
+	exceeded := false
+	if b.isRate {
+		exceeded = (complete || total >= minErrorBudgetSamples) && total > 0 &&
+			float64(failed) / float64(total) > b.rate
+	} else {
+		exceeded = failed > b.count
+	}
+	if !exceeded {
+		return nil
+	}
+
+	var breakdown []string
+	for _, errorCount := range results.errorBreakdown() {
+		breakdown = append(breakdown, fmt.Sprintf("%s/%d: %d", errorCount.Code, errorCount.Status, errorCount.Count))
+	}
+	return fmt.Errorf("%w: %d of %d requests failed, budget %s (%s)", ErrErrorBudgetExceeded, failed, total, b,
+		strings.Join(breakdown, ", "))
+}
+
+// errorKey classifies a failed request by the error code and the HTTP status code of its response.
+type errorKey struct {
+	code string
+	status int
+}
+
+// errorTotals counts the failed requests of a class, with the message of the first one.
+type errorTotals struct {
+	count int64
+	message string
+}
+
+// classifyError returns the class of the error of a request: the S3 error code (e.g. "SlowDown",
+// "RequestError" for network errors, "RequestCanceled" for timeouts) and the HTTP status of the response, if any.
+func classifyError(result opResult, err error) (errorKey, string) {
+	key := errorKey{code: "Unknown", status: result.status}
+	message := err.Error()
+	var aerr awserr.Error
+	if errors.As(err, &aerr) {
+		key.code = aerr.Code()
+		message = aerr.Message()
+	}
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) && key.status == 0 {
+		key.status = reqErr.StatusCode()
+	}
+	return key, message
+}
+
+// recordError adds a failed request to the recorder.
+func (r *recorder) recordError(result opResult, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(result.operation) > 0 {
+		if r.operations == nil {
+			r.operations = make(map[string]*recorder)
+		}
+		if _, ok := r.operations[result.operation]; !ok {
+			r.operations[result.operation] = newRecorder()
+		}
+		opResult := result
+		opResult.operation = ""
+		r.operations[result.operation].recordError(opResult, err)
+	}
+
+	key, message := classifyError(result, err)
+	if r.errors == nil {
+		r.errors = make(map[errorKey]*errorTotals)
+	}
+	if _, ok := r.errors[key]; !ok {
+		r.errors[key] = &errorTotals{message: message}
+	}
+	r.errors[key].count++
+	r.failed++
+}
+
+// errorCounts returns the no. of failed requests and the total no. of requests.
+func (r *recorder) errorCounts() (int64, int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.failed, r.failed + r.count
+}
+
+// errorBreakdown returns the no. of failed requests of each error code and HTTP status, most frequent first.
+func (r *recorder) errorBreakdown() []ErrorCount {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var breakdown []ErrorCount
+	for key, totals := range r.errors {
+		breakdown = append(breakdown, ErrorCount{
+			Code:    key.code,
+			Status:  key.status,
+			Count:   totals.count,
+			Message: totals.message,
+		})
+	}
+	sort.Slice(breakdown, func(i, j int) bool {
+		if breakdown[i].Count != breakdown[j].Count {
+			return breakdown[i].Count > breakdown[j].Count
+		}
+		if breakdown[i].Code != breakdown[j].Code {
+			return breakdown[i].Code < breakdown[j].Code
+		}
+		return breakdown[i].Status < breakdown[j].Status
+	})
+	return breakdown
+}
+
+// errorStats returns the no. of requests, the no. and rate of failed requests and their breakdown.
+func (r *recorder) errorStats() *NumericErrorStats {
+	failed, total := r.errorCounts()
+	stats := &NumericErrorStats{
+		Requests:  total,
+		Failed:    failed,
+		Rate:      &Metric{Value: 0, Unit: "%"},
+		Breakdown: r.errorBreakdown(),
+	}
+	if total > 0 {
+		stats.Rate.Value = float64(failed) / float64(total) * 100
+	}
+	return stats
+}
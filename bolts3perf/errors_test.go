@@ -0,0 +1,133 @@
+package bolts3perf
+
+import (
+	"errors"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseErrorBudget(t *testing.T) {
+	tests := []struct {
+		s string
+		want errorBudget
+		str string
+		wantErr bool
+	}{
+		{s: "0", want: errorBudget{count: 0}, str: "0"},
+		{s: "50", want: errorBudget{count: 50}, str: "50"},
+		{s: " 50 ", want: errorBudget{count: 50}, str: "50"},
+		{s: "5%", want: errorBudget{rate: 0.05, isRate: true}, str: "5%"},
+		{s: "0.5 %", want: errorBudget{rate: 0.005, isRate: true}, str: "0.5%"},
+		{s: "0%", want: errorBudget{rate: 0, isRate: true}, str: "0%"},
+		{s: "100%", want: errorBudget{rate: 1, isRate: true}, str: "100%"},
+		{s: "", wantErr: true},
+		{s: "%", wantErr: true},
+		{s: "-1", wantErr: true},
+		{s: "-1%", wantErr: true},
+		{s: "100.5%", wantErr: true},
+		{s: "1.5", wantErr: true},
+		{s: "abc", wantErr: true},
+		{s: "5%%", wantErr: true},
+		{s: "NaN%", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := parseErrorBudget(tt.s)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseErrorBudget(%q) = %+v, want an error", tt.s, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseErrorBudget(%q) error = %v", tt.s, err)
+			}
+			if *got != tt.want {
+				t.Errorf("parseErrorBudget(%q) = %+v, want %+v", tt.s, *got, tt.want)
+			}
+			if got.String() != tt.str {
+				t.Errorf("String() = %q, want %q", got.String(), tt.str)
+			}
+		})
+	}
+}
+
+func TestErrorBudgetCheck(t *testing.T) {
+	tests := []struct {
+		name string
+		budget string
+		succeeded int
+		failed int
+		complete bool
+		exceeded bool
+	}{
+		{name: "count within budget", budget: "5", succeeded: 10, failed: 5},
+		{name: "count exceeded", budget: "5", succeeded: 10, failed: 6, exceeded: true},
+		{name: "count exceeded before the end", budget: "0", succeeded: 0, failed: 1, exceeded: true},
+		{name: "rate within budget", budget: "10%", succeeded: 90, failed: 10},
+		{name: "rate exceeded", budget: "10%", succeeded: 89, failed: 11, exceeded: true},
+		{name: "rate with too few requests", budget: "10%", succeeded: 5, failed: 5},
+		{name: "rate with too few requests, complete", budget: "10%", succeeded: 5, failed: 5, complete: true,
+			exceeded: true},
+		{name: "rate without requests", budget: "0%", complete: true},
+		{name: "zero rate", budget: "0%", succeeded: 199, failed: 1, complete: true, exceeded: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := parseErrorBudget(tt.budget)
+			if err != nil {
+				t.Fatalf("parseErrorBudget(%q) error = %v", tt.budget, err)
+			}
+			r := newRecorder()
+			for i := 0; i < tt.succeeded; i++ {
+				r.record(opResult{latency: time.Millisecond})
+			}
+			for i := 0; i < tt.failed; i++ {
+				r.recordError(opResult{status: http.StatusServiceUnavailable}, awserr.New("SlowDown", "slow down", nil))
+			}
+
+			err = b.check(r, tt.complete)
+			if tt.exceeded != (err != nil) {
+				t.Fatalf("check() error = %v, want exceeded %t", err, tt.exceeded)
+			}
+			if err != nil && !errors.Is(err, ErrErrorBudgetExceeded) {
+				t.Errorf("check() error = %v, want ErrErrorBudgetExceeded", err)
+			}
+		})
+	}
+}
+
+func TestErrorStats(t *testing.T) {
+	r := newRecorder()
+	for i := 0; i < 6; i++ {
+		r.record(opResult{latency: time.Millisecond})
+	}
+	r.recordError(opResult{}, awserr.New("RequestError", "send request failed", nil))
+	r.recordError(opResult{status: http.StatusServiceUnavailable}, awserr.New("SlowDown", "slow down", nil))
+	r.recordError(opResult{status: http.StatusServiceUnavailable}, awserr.New("SlowDown", "slow down again", nil))
+	r.recordError(opResult{}, awserr.NewRequestFailure(awserr.New("InternalError", "internal error", nil),
+		http.StatusInternalServerError, "id"))
+
+	stats := r.errorStats()
+	if stats.Requests != 10 || stats.Failed != 4 || stats.Rate.Value != 40 {
+		t.Errorf("errorStats() = %d requests, %d failed, rate %g, want 10, 4, 40", stats.Requests, stats.Failed,
+			stats.Rate.Value)
+	}
+	want := []ErrorCount{
+		{Code: "SlowDown", Status: http.StatusServiceUnavailable, Count: 2, Message: "slow down"},
+		{Code: "InternalError", Status: http.StatusInternalServerError, Count: 1, Message: "internal error"},
+		{Code: "RequestError", Status: 0, Count: 1, Message: "send request failed"},
+	}
+	if len(stats.Breakdown) != len(want) {
+		t.Fatalf("Breakdown = %+v, want %+v", stats.Breakdown, want)
+	}
+	for i := range want {
+		if stats.Breakdown[i] != want[i] {
+			t.Errorf("Breakdown[%d] = %+v, want %+v", i, stats.Breakdown[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package bolts3perf
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Export formats of the per-request records.
+const (
+	exportFormatCSV = "CSV"
+	exportFormatJSONL = "JSONL"
+)
+
+// csvHeader is the header row of records exported as CSV.
+var csvHeader = []string{"operation", "target", "concurrency", "key", "size", "start", "intended", "latency_ms",
+	"ttfb_ms", "status", "retries", "error", "dns_ms", "connect_ms", "tls_ms", "write_ms", "first_byte_ms", "transfer_ms"}
+
+// RequestRecord is the raw measurement of a single request, as exported by a perf run.
+type RequestRecord struct {
+	Operation string `json:"operation"`
+	Target string `json:"target"`
+	Concurrency int `json:"concurrency"`
+	Key string `json:"key,omitempty"`
+	Size int64 `json:"size"`
+	Start time.Time `json:"start"`
+	// intended start of the request in target-rate mode; the latency is measured from the actual start.
+	Intended *time.Time `json:"intended,omitempty"`
+	LatencyMs float64 `json:"latencyMs"`
+	TTFBMs float64 `json:"ttfbMs"`
+	Status int `json:"status"`
+	Retries int `json:"retries"`
+	Error string `json:"error,omitempty"`
+	// duration of each phase of the request, if the phase occurred (see NumericPhaseStats).
+	DNSMs *float64 `json:"dnsMs,omitempty"`
+	ConnectMs *float64 `json:"connectMs,omitempty"`
+	TLSMs *float64 `json:"tlsMs,omitempty"`
+	WriteMs *float64 `json:"writeMs,omitempty"`
+	FirstByteMs *float64 `json:"firstByteMs,omitempty"`
+	TransferMs *float64 `json:"transferMs,omitempty"`
+}
+
+// ExportSummary describes the records exported by a perf run.
+type ExportSummary struct {
+	Location string `json:"location"`
+	Format string `json:"format"`
+	Records int64 `json:"records"`
+}
+
+// exporter writes the per-request records of a perf run as CSV or JSON Lines to a local file, or to a temporary
+// file that is uploaded to S3 / Bolt once the run is complete.
+type exporter struct {
+	mu sync.Mutex
+	format string
+	location string
+	file *os.File
+	w *bufio.Writer
+	csvWriter *csv.Writer
+	records int64
+	// S3 / Bolt client, bucket and key the records are uploaded to, if exported to S3 / Bolt.
+	svc *s3.S3
+	bucket string
+	key string
+}
+
+// newExporter creates an exporter that writes records in the given format (csv or jsonl) to location: a local
+// path, or s3://<bucket>/<key> or bolt://<bucket>/<key> to upload the records to S3 / Bolt. If location ends
+// with '/', a file name is generated from the current time.
+func (p *BoltS3Perf) newExporter(format string, location string) (*exporter, error) {
+
+	e := &exporter{format: strings.ToUpper(format)}
+	if len(e.format) == 0 {
+		e.format = exportFormatCSV
+	}
+	if e.format != exportFormatCSV && e.format != exportFormatJSONL {
+		return nil, fmt.Errorf("invalid exportFormat: %s", format)
+	}
+
+	if strings.HasSuffix(location, "/") {
+		location += fmt.Sprintf("bolt-s3-perf-%s.%s", time.Now().UTC().Format("20060102T150405Z"),
+			strings.ToLower(e.format))
+	}
+	e.location = location
+
+	var err error
+	if strings.HasPrefix(location, "s3://") || strings.HasPrefix(location, "bolt://") {
+		e.svc, e.bucket, e.key, err = p.objectLocation(location)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exportPath: %s", location)
+		}
+		e.file, err = ioutil.TempFile("", "bolt-s3-perf-")
+	} else {
+		e.file, err = os.Create(location)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	e.w = bufio.NewWriter(e.file)
+	if e.format == exportFormatCSV {
+		e.csvWriter = csv.NewWriter(e.w)
+		if err := e.csvWriter.Write(csvHeader); err != nil {
+			e.file.Close()
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// write appends the record to the export.
+func (e *exporter) write(record *RequestRecord) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.records++
+	if e.format == exportFormatCSV {
+		return e.csvWriter.Write([]string{
+			record.Operation,
+			record.Target,
+			strconv.Itoa(record.Concurrency),
+			record.Key,
+			strconv.FormatInt(record.Size, 10),
+			record.Start.Format(time.RFC3339Nano),
+			formatTime(record.Intended),
+			strconv.FormatFloat(record.LatencyMs, 'f', 6, 64),
+			strconv.FormatFloat(record.TTFBMs, 'f', 6, 64),
+			strconv.Itoa(record.Status),
+			strconv.Itoa(record.Retries),
+			record.Error,
+			formatMs(record.DNSMs),
+			formatMs(record.ConnectMs),
+			formatMs(record.TLSMs),
+			formatMs(record.WriteMs),
+			formatMs(record.FirstByteMs),
+			formatMs(record.TransferMs),
+		})
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	_, err = e.w.Write(data)
+	return err
+}
+
+// close flushes the records to the file and, if the records are exported to S3 / Bolt, uploads the file.
+func (e *exporter) close() (*ExportSummary, error) {
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	defer e.file.Close()
+
+	if e.csvWriter != nil {
+		e.csvWriter.Flush()
+		if err := e.csvWriter.Error(); err != nil {
+			return nil, err
+		}
+	}
+	if err := e.w.Flush(); err != nil {
+		return nil, err
+	}
+
+	if e.svc != nil {
+		defer os.Remove(e.file.Name())
+		if _, err := e.file.Seek(0, 0); err != nil {
+			return nil, err
+		}
+		contentType := "text/csv"
+		if e.format == exportFormatJSONL {
+			contentType = "application/x-ndjson"
+		}
+		_, err := e.svc.PutObject(&s3.PutObjectInput{
+			Bucket:      aws.String(e.bucket),
+			Key:         aws.String(e.key),
+			Body:        e.file,
+			ContentType: aws.String(contentType),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &ExportSummary{Location: e.location, Format: strings.ToLower(e.format), Records: e.records}, nil
+}
+
+// formatTime formats the time as RFC 3339 with nanoseconds, or returns an empty string if there is no time.
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// formatMs formats a duration in ms with nanosecond precision, or returns an empty string if there is none.
+func formatMs(ms *float64) string {
+	if ms == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*ms, 'f', 6, 64)
+}
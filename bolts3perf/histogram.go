@@ -0,0 +1,477 @@
+package bolts3perf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/bits"
+)
+
+// Cookies of the HdrHistogram V2 encoding (with LEB128 ZigZag encoded counts).
+const (
+	encodingCookie           = 0x1c849303 | 0x10
+	compressedEncodingCookie = 0x1c849304 | 0x10
+	encodingHeaderSize       = 40
+)
+
+// Histogram is an HDR (High Dynamic Range) histogram that records integer values between 0 and a highest
+// trackable value with a fixed no. of significant decimal digits of precision. Its memory footprint depends
+// on its value range and precision only, not on the no. of recorded values, and histograms with the same
+// configuration can be merged without any loss of accuracy.
+//
+// Histograms are encoded using the HdrHistogram V2 compressed encoding (base64), so that they can be decoded,
+// merged and analyzed with any HdrHistogram implementation (e.g. Java HdrHistogram, Python hdrh).
+type Histogram struct {
+	lowestTrackableValue int64
+	highestTrackableValue int64
+	significantFigures int
+	unitMagnitude uint
+	subBucketHalfCountMagnitude uint
+	subBucketHalfCount int
+	subBucketCount int
+	subBucketMask int64
+	leadingZeroCountBase int
+	totalCount int64
+	min int64
+	max int64
+	counts []int64
+}
+
+// NewHistogram creates a histogram that tracks values from 0 up to highestTrackableValue, distinguishing
+// values of at least lowestTrackableValue (>= 1) with significantFigures (1 - 5) significant decimal digits.
+func NewHistogram(lowestTrackableValue int64, highestTrackableValue int64, significantFigures int) *Histogram {
+
+	if lowestTrackableValue < 1 {
+		lowestTrackableValue = 1
+	}
+	if significantFigures < 1 {
+		significantFigures = 1
+	} else if significantFigures > 5 {
+		significantFigures = 5
+	}
+	if highestTrackableValue < 2 * lowestTrackableValue {
+		highestTrackableValue = 2 * lowestTrackableValue
+	}
+
+	largestValueWithSingleUnitResolution := 2 * math.Pow10(significantFigures)
+	subBucketCountMagnitude := uint(math.Ceil(math.Log2(largestValueWithSingleUnitResolution)))
+	subBucketHalfCountMagnitude := subBucketCountMagnitude - 1
+	unitMagnitude := uint(math.Floor(math.Log2(float64(lowestTrackableValue))))
+	subBucketCount := 1 << (subBucketHalfCountMagnitude + 1)
+
+	// no. of buckets needed to cover the highest trackable value.
+	smallestUntrackableValue := int64(subBucketCount) << unitMagnitude
+	bucketCount := 1
+	for smallestUntrackableValue <= highestTrackableValue {
+		if smallestUntrackableValue > math.MaxInt64 / 2 {
+			bucketCount++
+			break
+		}
+		smallestUntrackableValue <<= 1
+		bucketCount++
+	}
+
+	return &Histogram{
+		lowestTrackableValue:        lowestTrackableValue,
+		highestTrackableValue:       highestTrackableValue,
+		significantFigures:          significantFigures,
+		unitMagnitude:               unitMagnitude,
+		subBucketHalfCountMagnitude: subBucketHalfCountMagnitude,
+		subBucketHalfCount:          subBucketCount / 2,
+		subBucketCount:              subBucketCount,
+		subBucketMask:               int64(subBucketCount - 1) << unitMagnitude,
+		leadingZeroCountBase:        64 - int(unitMagnitude) - int(subBucketHalfCountMagnitude) - 1,
+		min:                         math.MaxInt64,
+		counts:                      make([]int64, (bucketCount + 1) * (subBucketCount / 2)),
+	}
+}
+
+// RecordValue records a value. Negative values are recorded as 0, and values above the highest trackable
+// value are recorded as the highest trackable value.
+func (h *Histogram) RecordValue(v int64) {
+	h.RecordValues(v, 1)
+}
+
+// RecordValues records n occurrences of a value.
+func (h *Histogram) RecordValues(v int64, n int64) {
+	if n <= 0 {
+		return
+	}
+	if v < 0 {
+		v = 0
+	} else if v > h.highestTrackableValue {
+		v = h.highestTrackableValue
+	}
+
+	h.counts[h.countsIndexFor(v)] += n
+	h.totalCount += n
+	if v < h.min {
+		h.min = v
+	}
+	if v > h.max {
+		h.max = v
+	}
+}
+
+// Merge adds the values recorded in other to the histogram. Histograms with the same configuration are
+// merged exactly, otherwise the values of other are re-recorded at the precision of the histogram.
+func (h *Histogram) Merge(other *Histogram) {
+	if other.totalCount == 0 {
+		return
+	}
+
+	if h.sameLayout(other) {
+		for i, count := range other.counts {
+			h.counts[i] += count
+		}
+		h.totalCount += other.totalCount
+		if other.min < h.min {
+			h.min = other.min
+		}
+		if other.max > h.max {
+			h.max = other.max
+		}
+		return
+	}
+
+	for i, count := range other.counts {
+		if count > 0 {
+			h.RecordValues(other.medianEquivalentValue(other.valueFromIndex(i)), count)
+		}
+	}
+}
+
+// TotalCount returns the no. of recorded values.
+func (h *Histogram) TotalCount() int64 {
+	return h.totalCount
+}
+
+// Min returns the smallest recorded value, as the lowest value equivalent to it within the precision of the
+// histogram.
+func (h *Histogram) Min() int64 {
+	if h.totalCount == 0 || h.min == 0 {
+		return 0
+	}
+	return h.lowestEquivalentValue(h.min)
+}
+
+// Max returns the largest recorded value, as the highest value equivalent to it within the precision of the
+// histogram.
+func (h *Histogram) Max() int64 {
+	if h.totalCount == 0 {
+		return 0
+	}
+	return h.highestEquivalentValue(h.max)
+}
+
+// Mean returns the mean of the recorded values, each value being approximated by the middle of its bucket.
+func (h *Histogram) Mean() float64 {
+	if h.totalCount == 0 {
+		return 0
+	}
+	var total float64 = 0
+	for i, count := range h.counts {
+		if count > 0 {
+			total += float64(h.medianEquivalentValue(h.valueFromIndex(i))) * float64(count)
+		}
+	}
+	return total / float64(h.totalCount)
+}
+
+// StdDev returns the (population) standard deviation of the recorded values.
+func (h *Histogram) StdDev() float64 {
+	if h.totalCount == 0 {
+		return 0
+	}
+	mean := h.Mean()
+	var total float64 = 0
+	for i, count := range h.counts {
+		if count > 0 {
+			dev := float64(h.medianEquivalentValue(h.valueFromIndex(i))) - mean
+			total += dev * dev * float64(count)
+		}
+	}
+	return math.Sqrt(total / float64(h.totalCount))
+}
+
+// ValueAtPercentile returns the value at the given percentile (0 - 100): the largest value that is equivalent
+// (within the precision of the histogram) to the value of rank ceil(percentile / 100 * TotalCount).
+func (h *Histogram) ValueAtPercentile(percentile float64) int64 {
+	if h.totalCount == 0 {
+		return 0
+	}
+
+	requested := math.Min(math.Max(math.Nextafter(percentile, math.Inf(-1)), 0), 100)
+	countAtPercentile := int64(math.Ceil(requested / 100 * float64(h.totalCount)))
+	if countAtPercentile < 1 {
+		countAtPercentile = 1
+	}
+
+	var total int64 = 0
+	for i, count := range h.counts {
+		total += count
+		if total >= countAtPercentile {
+			value := h.valueFromIndex(i)
+			if percentile == 0 {
+				return h.lowestEquivalentValue(value)
+			}
+			return h.highestEquivalentValue(value)
+		}
+	}
+	return h.Max()
+}
+
+// InterpolatedValueAtPercentile returns the value at the given percentile (0 - 100), interpolated linearly
+// between the values of adjacent ranks: with the recorded values in increasing order, ranked from 0, the
+// percentile is at rank r = percentile / 100 * (TotalCount - 1), between the values of ranks floor(r) and
+// floor(r) + 1. The value of a rank is the middle value of its bucket, so that the result is within the precision
+// of the histogram.
+func (h *Histogram) InterpolatedValueAtPercentile(percentile float64) float64 {
+	if h.totalCount == 0 {
+		return 0
+	}
+
+	rank := math.Min(math.Max(percentile, 0), 100) / 100 * float64(h.totalCount - 1)
+	lower := int64(math.Floor(rank))
+	upper := lower + 1
+	if upper >= h.totalCount {
+		upper = h.totalCount - 1
+	}
+	lowerValue := float64(h.valueAtRank(lower))
+	upperValue := float64(h.valueAtRank(upper))
+	return lowerValue + (rank - float64(lower)) * (upperValue - lowerValue)
+}
+
+// valueAtRank returns the middle value of the bucket of the recorded value of the rank (from 0), in increasing
+// order.
+func (h *Histogram) valueAtRank(rank int64) int64 {
+	var total int64 = 0
+	for i, count := range h.counts {
+		total += count
+		if total > rank {
+			return h.medianEquivalentValue(h.valueFromIndex(i))
+		}
+	}
+	return h.medianEquivalentValue(h.max)
+}
+
+// forEachValue calls fn with the middle value of each non-empty bucket and its count.
+func (h *Histogram) forEachValue(fn func(value int64, count int64)) {
+	for i, count := range h.counts {
+		if count > 0 {
+			fn(h.medianEquivalentValue(h.valueFromIndex(i)), count)
+		}
+	}
+}
+
+// Encode returns the HdrHistogram V2 compressed encoding of the histogram, base64 encoded.
+func (h *Histogram) Encode() (string, error) {
+
+	var payload bytes.Buffer
+	if h.totalCount > 0 {
+		countsLimit := h.countsIndexFor(h.max) + 1
+		varint := make([]byte, 9)
+		for i := 0; i < countsLimit; {
+			count := h.counts[i]
+			i++
+
+			// runs of zero counts are encoded as a negative no. of zeros.
+			zeros := int64(0)
+			if count == 0 {
+				zeros = 1
+				for i < countsLimit && h.counts[i] == 0 {
+					zeros++
+					i++
+				}
+			}
+			if zeros > 1 {
+				payload.Write(varint[:putZigZag(varint, -zeros)])
+			} else {
+				payload.Write(varint[:putZigZag(varint, count)])
+			}
+		}
+	}
+
+	var encoded bytes.Buffer
+	header := make([]byte, encodingHeaderSize)
+	binary.BigEndian.PutUint32(header[0:], encodingCookie)
+	binary.BigEndian.PutUint32(header[4:], uint32(payload.Len()))
+	binary.BigEndian.PutUint32(header[8:], 0) // normalizing index offset
+	binary.BigEndian.PutUint32(header[12:], uint32(h.significantFigures))
+	binary.BigEndian.PutUint64(header[16:], uint64(h.lowestTrackableValue))
+	binary.BigEndian.PutUint64(header[24:], uint64(h.highestTrackableValue))
+	binary.BigEndian.PutUint64(header[32:], math.Float64bits(1.0)) // integer to double value conversion ratio
+	encoded.Write(header)
+	encoded.Write(payload.Bytes())
+
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	if _, err := zw.Write(encoded.Bytes()); err != nil {
+		return "", err
+	}
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+
+	out := make([]byte, 8, 8 + compressed.Len())
+	binary.BigEndian.PutUint32(out[0:], compressedEncodingCookie)
+	binary.BigEndian.PutUint32(out[4:], uint32(compressed.Len()))
+	out = append(out, compressed.Bytes()...)
+	return base64.StdEncoding.EncodeToString(out), nil
+}
+
+// DecodeHistogram decodes a histogram from its base64 HdrHistogram V2 compressed encoding, as returned by Encode.
+func DecodeHistogram(encoded string) (*Histogram, error) {
+
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 8 || binary.BigEndian.Uint32(data[0:]) != compressedEncodingCookie {
+		return nil, errors.New("histogram: not an HdrHistogram V2 compressed encoding")
+	}
+	length := int(binary.BigEndian.Uint32(data[4:]))
+	if len(data) < 8 + length {
+		return nil, errors.New("histogram: truncated encoding")
+	}
+
+	zr, err := zlib.NewReader(bytes.NewReader(data[8 : 8 + length]))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	data, err = ioutil.ReadAll(zr)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < encodingHeaderSize || binary.BigEndian.Uint32(data[0:]) != encodingCookie {
+		return nil, errors.New("histogram: unsupported encoding")
+	}
+	payloadLength := int(binary.BigEndian.Uint32(data[4:]))
+	significantFigures := int(binary.BigEndian.Uint32(data[12:]))
+	lowestTrackableValue := int64(binary.BigEndian.Uint64(data[16:]))
+	highestTrackableValue := int64(binary.BigEndian.Uint64(data[24:]))
+	if len(data) < encodingHeaderSize + payloadLength {
+		return nil, errors.New("histogram: truncated payload")
+	}
+
+	h := NewHistogram(lowestTrackableValue, highestTrackableValue, significantFigures)
+	payload := data[encodingHeaderSize : encodingHeaderSize + payloadLength]
+	for i, pos := 0, 0; pos < len(payload); {
+		value, n := getZigZag(payload[pos:])
+		if n <= 0 {
+			return nil, errors.New("histogram: invalid counts encoding")
+		}
+		pos += n
+
+		if value < 0 {
+			i += int(-value)
+			continue
+		}
+		if i >= len(h.counts) {
+			return nil, fmt.Errorf("histogram: counts index %d out of range", i)
+		}
+		if value > 0 {
+			h.RecordValues(h.valueFromIndex(i), value)
+		}
+		i++
+	}
+	return h, nil
+}
+
+func (h *Histogram) sameLayout(other *Histogram) bool {
+	return h.unitMagnitude == other.unitMagnitude &&
+		h.subBucketHalfCountMagnitude == other.subBucketHalfCountMagnitude &&
+		len(h.counts) == len(other.counts)
+}
+
+func (h *Histogram) bucketIndex(v int64) int {
+	return h.leadingZeroCountBase - bits.LeadingZeros64(uint64(v | h.subBucketMask))
+}
+
+func (h *Histogram) subBucketIndex(v int64, bucketIndex int) int {
+	return int(v >> (uint(bucketIndex) + h.unitMagnitude))
+}
+
+func (h *Histogram) countsIndexFor(v int64) int {
+	bucketIndex := h.bucketIndex(v)
+	subBucketIndex := h.subBucketIndex(v, bucketIndex)
+	return ((bucketIndex + 1) << h.subBucketHalfCountMagnitude) + (subBucketIndex - h.subBucketHalfCount)
+}
+
+func (h *Histogram) valueFromIndex(index int) int64 {
+	bucketIndex := (index >> h.subBucketHalfCountMagnitude) - 1
+	subBucketIndex := (index & (h.subBucketHalfCount - 1)) + h.subBucketHalfCount
+	if bucketIndex < 0 {
+		subBucketIndex -= h.subBucketHalfCount
+		bucketIndex = 0
+	}
+	return int64(subBucketIndex) << (uint(bucketIndex) + h.unitMagnitude)
+}
+
+func (h *Histogram) sizeOfEquivalentValueRange(v int64) int64 {
+	bucketIndex := h.bucketIndex(v)
+	subBucketIndex := h.subBucketIndex(v, bucketIndex)
+	adjustedBucket := bucketIndex
+	if subBucketIndex >= h.subBucketCount {
+		adjustedBucket++
+	}
+	return int64(1) << (h.unitMagnitude + uint(adjustedBucket))
+}
+
+func (h *Histogram) lowestEquivalentValue(v int64) int64 {
+	bucketIndex := h.bucketIndex(v)
+	subBucketIndex := h.subBucketIndex(v, bucketIndex)
+	return int64(subBucketIndex) << (uint(bucketIndex) + h.unitMagnitude)
+}
+
+func (h *Histogram) highestEquivalentValue(v int64) int64 {
+	return h.lowestEquivalentValue(v) + h.sizeOfEquivalentValueRange(v) - 1
+}
+
+func (h *Histogram) medianEquivalentValue(v int64) int64 {
+	return h.lowestEquivalentValue(v) + h.sizeOfEquivalentValueRange(v) >> 1
+}
+
+// putZigZag writes the ZigZag LEB128 encoding of v (at most 9 bytes) to buf and returns the no. of bytes written.
+func putZigZag(buf []byte, v int64) int {
+	u := uint64((v << 1) ^ (v >> 63))
+	for i := 0; i < 8; i++ {
+		if u >> 7 == 0 {
+			buf[i] = byte(u)
+			return i + 1
+		}
+		buf[i] = byte(u & 0x7f) | 0x80
+		u >>= 7
+	}
+	// the 9th byte holds the remaining 8 bits.
+	buf[8] = byte(u)
+	return 9
+}
+
+// getZigZag decodes a ZigZag LEB128 encoded value from buf and returns the value and the no. of bytes read,
+// or a no. of bytes <= 0 if buf is truncated.
+func getZigZag(buf []byte) (int64, int) {
+	var u uint64 = 0
+	for i := 0; i < 9; i++ {
+		if i >= len(buf) {
+			return 0, 0
+		}
+		b := uint64(buf[i])
+		if i == 8 {
+			u |= b << 56
+			return int64(u >> 1) ^ -int64(u & 1), 9
+		}
+		u |= (b & 0x7f) << (7 * uint(i))
+		if b & 0x80 == 0 {
+			return int64(u >> 1) ^ -int64(u & 1), i + 1
+		}
+	}
+	return 0, 0
+}
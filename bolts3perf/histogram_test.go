@@ -0,0 +1,264 @@
+package bolts3perf
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// withinPrecision returns whether got is equivalent to want within 3 significant digits.
+func withinPrecision(got int64, want int64) bool {
+	return math.Abs(float64(got - want)) <= math.Max(1, float64(want) / 1000)
+}
+
+// newTestHistogram returns a latency histogram recording the values.
+func newTestHistogram(values []int64) *Histogram {
+	h := NewHistogram(1, maxRecordedLatency, 3)
+	for _, v := range values {
+		h.RecordValue(v)
+	}
+	return h
+}
+
+// sequence returns the values from, from + step, ... up to n values.
+func sequence(from int64, step int64, n int) []int64 {
+	values := make([]int64, n)
+	for i := range values {
+		values[i] = from + int64(i) * step
+	}
+	return values
+}
+
+func TestHistogramPercentiles(t *testing.T) {
+	tests := []struct {
+		name string
+		values []int64
+		min int64
+		max int64
+		percentiles map[float64]int64
+	}{
+		{
+			name:        "single unit resolution",
+			values:      sequence(1, 1, 1000),
+			min:         1,
+			max:         1000,
+			percentiles: map[float64]int64{0: 1, 50: 500, 90: 900, 99: 990, 99.9: 999, 100: 1000},
+		},
+		{
+			name:        "milliseconds",
+			values:      sequence(int64(time.Millisecond), int64(time.Millisecond), 1000),
+			min:         int64(time.Millisecond),
+			max:         int64(time.Second),
+			percentiles: map[float64]int64{50: int64(500 * time.Millisecond), 99: int64(990 * time.Millisecond)},
+		},
+		{
+			name:        "zeros",
+			values:      []int64{0, 0, 0},
+			min:         0,
+			max:         0,
+			percentiles: map[float64]int64{0: 0, 50: 0, 100: 0},
+		},
+		{
+			name:        "highest trackable value",
+			values:      []int64{0, maxRecordedLatency, maxRecordedLatency * 2},
+			min:         0,
+			max:         maxRecordedLatency,
+			percentiles: map[float64]int64{0: 0, 50: maxRecordedLatency, 100: maxRecordedLatency},
+		},
+		{
+			name:        "negative values",
+			values:      []int64{-5, 10},
+			min:         0,
+			max:         10,
+			percentiles: map[float64]int64{50: 0, 100: 10},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHistogram(tt.values)
+			if h.TotalCount() != int64(len(tt.values)) {
+				t.Errorf("TotalCount() = %d, want %d", h.TotalCount(), len(tt.values))
+			}
+			if !withinPrecision(h.Min(), tt.min) {
+				t.Errorf("Min() = %d, want %d", h.Min(), tt.min)
+			}
+			if !withinPrecision(h.Max(), tt.max) {
+				t.Errorf("Max() = %d, want %d", h.Max(), tt.max)
+			}
+			for percentile, want := range tt.percentiles {
+				if got := h.ValueAtPercentile(percentile); !withinPrecision(got, want) {
+					t.Errorf("ValueAtPercentile(%g) = %d, want %d", percentile, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestHistogramInterpolatedPercentiles(t *testing.T) {
+	tests := []struct {
+		name string
+		values []int64
+		percentiles map[float64]float64
+	}{
+		{
+			name:        "single unit resolution",
+			values:      sequence(1, 1, 1000),
+			percentiles: map[float64]float64{0: 1, 50: 500.5, 90: 900.1, 99: 990.01, 99.9: 999.001, 100: 1000},
+		},
+		{
+			name:        "between adjacent ranks",
+			values:      []int64{10, 20, 30, 40},
+			percentiles: map[float64]float64{0: 10, 25: 17.5, 50: 25, 90: 37, 100: 40},
+		},
+		{
+			name:        "single value",
+			values:      []int64{42},
+			percentiles: map[float64]float64{0: 42, 50: 42, 100: 42},
+		},
+		{
+			name:        "milliseconds",
+			values:      sequence(int64(time.Millisecond), int64(time.Millisecond), 1000),
+			percentiles: map[float64]float64{
+				50: 500.5 * float64(time.Millisecond),
+				99: 990.01 * float64(time.Millisecond),
+			},
+		},
+		{
+			name:        "empty",
+			values:      nil,
+			percentiles: map[float64]float64{50: 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHistogram(tt.values)
+			for percentile, want := range tt.percentiles {
+				got := h.InterpolatedValueAtPercentile(percentile)
+				if math.Abs(got - want) > math.Max(1e-9, want / 1000) {
+					t.Errorf("InterpolatedValueAtPercentile(%g) = %g, want %g", percentile, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestHistogramEmpty(t *testing.T) {
+	h := newTestHistogram(nil)
+	if h.TotalCount() != 0 || h.Min() != 0 || h.Max() != 0 || h.ValueAtPercentile(50) != 0 || h.Mean() != 0 {
+		t.Errorf("empty histogram: count %d, min %d, max %d, p50 %d, mean %g", h.TotalCount(), h.Min(), h.Max(),
+			h.ValueAtPercentile(50), h.Mean())
+	}
+}
+
+func TestHistogramEncodeDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		values []int64
+	}{
+		{name: "empty", values: nil},
+		{name: "single value", values: []int64{int64(12345 * time.Microsecond)}},
+		{name: "zero", values: []int64{0, 0, 1}},
+		{name: "highest trackable value", values: []int64{1, maxRecordedLatency}},
+		{name: "wide range", values: append(sequence(1, 997, 5000), sequence(int64(time.Second), 7919, 5000)...)},
+		{name: "repeated values", values: append(sequence(100, 0, 300), sequence(int64(time.Minute), 0, 200)...)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHistogram(tt.values)
+			encoded, err := h.Encode()
+			if err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+			decoded, err := DecodeHistogram(encoded)
+			if err != nil {
+				t.Fatalf("DecodeHistogram() error = %v", err)
+			}
+
+			if !decoded.sameLayout(h) {
+				t.Fatalf("decoded histogram has a different layout")
+			}
+			for i := range h.counts {
+				if decoded.counts[i] != h.counts[i] {
+					t.Fatalf("counts[%d] = %d, want %d", i, decoded.counts[i], h.counts[i])
+				}
+			}
+			if decoded.TotalCount() != h.TotalCount() {
+				t.Errorf("TotalCount() = %d, want %d", decoded.TotalCount(), h.TotalCount())
+			}
+			if decoded.Min() != h.Min() || decoded.Max() != h.Max() {
+				t.Errorf("Min(), Max() = %d, %d, want %d, %d", decoded.Min(), decoded.Max(), h.Min(), h.Max())
+			}
+			for _, percentile := range []float64{0, 50, 90, 99, 99.9, 100} {
+				if decoded.ValueAtPercentile(percentile) != h.ValueAtPercentile(percentile) {
+					t.Errorf("ValueAtPercentile(%g) = %d, want %d", percentile, decoded.ValueAtPercentile(percentile),
+						h.ValueAtPercentile(percentile))
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeHistogramInvalid(t *testing.T) {
+	h := newTestHistogram([]int64{1, 2, 3})
+	encoded, err := h.Encode()
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	for _, encoded := range []string{"", "not base64!", "AAAAAAAAAAA=", encoded[:len(encoded) / 2]} {
+		if _, err := DecodeHistogram(encoded); err == nil {
+			t.Errorf("DecodeHistogram(%q) error = nil, want an error", encoded)
+		}
+	}
+}
+
+func TestHistogramMerge(t *testing.T) {
+	tests := []struct {
+		name string
+		a *Histogram
+		b *Histogram
+	}{
+		{
+			name: "same layout",
+			a:    newTestHistogram(sequence(1, 1, 500)),
+			b:    newTestHistogram(sequence(501, 1, 500)),
+		},
+		{
+			name: "empty",
+			a:    newTestHistogram(sequence(1, 1, 1000)),
+			b:    newTestHistogram(nil),
+		},
+		{
+			name: "different layout",
+			a:    newTestHistogram(sequence(1, 1, 500)),
+			b: func() *Histogram {
+				h := NewHistogram(1, 1 << 20, 3)
+				for _, v := range sequence(501, 1, 500) {
+					h.RecordValue(v)
+				}
+				return h
+			}(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := tt.a.TotalCount() + tt.b.TotalCount()
+			tt.a.Merge(tt.b)
+			if tt.a.TotalCount() != want {
+				t.Errorf("TotalCount() = %d, want %d", tt.a.TotalCount(), want)
+			}
+			if tt.a.Min() != 1 || tt.a.Max() != 1000 {
+				t.Errorf("Min(), Max() = %d, %d, want 1, 1000", tt.a.Min(), tt.a.Max())
+			}
+			for percentile, want := range map[float64]int64{50: 500, 99: 990, 100: 1000} {
+				if got := tt.a.ValueAtPercentile(percentile); got != want {
+					t.Errorf("ValueAtPercentile(%g) = %d, want %d", percentile, got, want)
+				}
+			}
+		})
+	}
+}
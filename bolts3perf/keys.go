@@ -0,0 +1,154 @@
+package bolts3perf
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"io"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// Strategies to choose the keys of get object perf tests among the keys of the bucket (or manifest).
+const (
+	// the first numKeys keys, in lexicographic order (or manifest order).
+	keySamplingFirst = "FIRST"
+	// numKeys keys sampled uniformly at random among all keys.
+	keySamplingRandom = "RANDOM"
+)
+
+// keySampler keeps the first n keys it is given, or a uniform random sample of n keys (reservoir sampling),
+// with the sizes of their objects (-1 if unknown).
+type keySampler struct {
+	n int
+	random bool
+	rand *rand.Rand
+	seen int
+	keys []string
+	sizes []int64
+}
+
+func newKeySampler(n int, sampling string) *keySampler {
+	return &keySampler{
+		n:      n,
+		random: sampling == keySamplingRandom,
+		rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// add offers a key and the size of its object to the sample, and returns whether more keys may still be added
+// to the sample.
+func (s *keySampler) add(key string, size int64) bool {
+	s.seen++
+	if len(s.keys) < s.n {
+		s.keys = append(s.keys, key)
+		s.sizes = append(s.sizes, size)
+	} else if s.random {
+		if j := s.rand.Intn(s.seen); j < s.n {
+			s.keys[j] = key
+			s.sizes[j] = size
+		}
+	}
+	return s.random || len(s.keys) < s.n
+}
+
+// loadKeys gets the keys of the get object perf tests: up to numKeys keys under the prefix, listed from the
+// bucket in S3, or read from the manifest if one is passed. With random sampling, all keys are listed (or read)
+// and numKeys of them are sampled uniformly, so that the tests reflect the whole dataset.
+func (p *BoltS3Perf) loadKeys(bucket string) error {
+
+	sampler := newKeySampler(p.numKeys, p.keySampling)
+	if len(p.manifest) > 0 {
+		if err := p.readManifest(sampler); err != nil {
+			return err
+		}
+	} else if err := p.listObjectsV2(bucket, sampler); err != nil {
+		return err
+	}
+	p.keys = append(p.keys, sampler.keys...)
+	for i, key := range sampler.keys {
+		if sampler.sizes[i] >= 0 {
+			p.objectSizes.set(key, sampler.sizes[i])
+		}
+	}
+	return nil
+}
+
+// listObjectsV2 lists the objects under the prefix from the given bucket in S3, one page after the other, and
+// adds their keys to the sampler until it is full.
+func (p *BoltS3Perf) listObjectsV2(bucket string, sampler *keySampler) error {
+	listObjsV2Input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+	}
+	if len(p.prefix) > 0 {
+		listObjsV2Input.Prefix = aws.String(p.prefix)
+	}
+
+	return p.s3Svc.ListObjectsV2Pages(listObjsV2Input, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, item := range page.Contents {
+			if !sampler.add(*item.Key, aws.Int64Value(item.Size)) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// readManifest reads the keys of the manifest (s3://<bucket>/<key> or bolt://<bucket>/<key>), a text file with
+// one key per line, optionally gzip compressed, and adds the keys under the prefix to the sampler until it is
+// full.
+func (p *BoltS3Perf) readManifest(sampler *keySampler) error {
+
+	svc, bucket, key, err := p.objectLocation(p.manifest)
+	if err != nil {
+		return fmt.Errorf("invalid manifest: %s", p.manifest)
+	}
+	output, err := svc.GetObject(&s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		return err
+	}
+	defer output.Body.Close()
+
+	var body io.Reader = output.Body
+	if aws.StringValue(output.ContentEncoding) == "gzip" || strings.HasSuffix(key, ".gz") {
+		gr, err := gzip.NewReader(output.Body)
+		if err != nil {
+			return err
+		}
+		defer gr.Close()
+		body = gr
+	}
+
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || !strings.HasPrefix(line, p.prefix) {
+			continue
+		}
+		if !sampler.add(line, -1) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// objectLocation parses the location of an object in S3 (s3://<bucket>/<key>) or Bolt (bolt://<bucket>/<key>),
+// and returns the client, bucket and key of the object.
+func (p *BoltS3Perf) objectLocation(location string) (*s3.S3, string, string, error) {
+	var svc *s3.S3
+	if strings.HasPrefix(location, "s3://") {
+		svc = p.s3Svc
+	} else if strings.HasPrefix(location, "bolt://") {
+		svc = p.boltSvc
+	} else {
+		return nil, "", "", fmt.Errorf("invalid location: %s", location)
+	}
+	parts := strings.SplitN(location[strings.Index(location, "://") + 3:], "/", 2)
+	if len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+		return nil, "", "", fmt.Errorf("invalid location: %s", location)
+	}
+	return svc, parts[0], parts[1], nil
+}
@@ -0,0 +1,453 @@
+package bolts3perf
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Operations of a mixed workload, in the order in which they are reported.
+var mixedOperations = []string{"get", "put", "head", "list", "delete"}
+
+// defaultMix is the mix of operations of a mixed workload if none is passed: a read-heavy workload.
+const defaultMix = "get=80,put=10,head=5,list=3,delete=2"
+
+// Key distributions of a mixed workload.
+const (
+	keyDistributionUniform = "UNIFORM"
+	keyDistributionZipfian = "ZIPFIAN"
+	keyDistributionHotspot = "HOTSPOT"
+)
+
+// Parameters of the zipfian and hotspot key distributions, as in YCSB: with a zipfian constant of 0.99 the most
+// popular keys are requested far more often than the others, and in the hotspot distribution 80% of the
+// operations request 20% of the keys.
+const (
+	zipfianConstant = 0.99
+	hotsetFraction = 0.2
+	hotOpnFraction = 0.8
+)
+
+// workload is a mix of operations, each with a weight, run against keys chosen with a key distribution.
+type workload struct {
+	operations []string
+	// cumulative weights of the operations.
+	cumWeights []float64
+	distribution string
+	keys keyChooser
+}
+
+// keyChooser chooses the index of the key of an operation, in [0, n), drawing from rng.
+type keyChooser interface {
+	next(rng *rand.Rand) int
+}
+
+// uniformChooser chooses every key with the same probability.
+type uniformChooser struct {
+	n int
+}
+
+func (c *uniformChooser) next(rng *rand.Rand) int {
+	return rng.Intn(c.n)
+}
+
+// hotspotChooser chooses a key of the hot set (the first keys) for a fraction of the operations, and a key of
+// the cold set for the others, uniformly within each set.
+type hotspotChooser struct {
+	n int
+	hot int
+}
+
+func (c *hotspotChooser) next(rng *rand.Rand) int {
+	if c.hot == c.n || rng.Float64() < hotOpnFraction {
+		return rng.Intn(c.hot)
+	}
+	return c.hot + rng.Intn(c.n - c.hot)
+}
+
+// zipfianChooser chooses keys following a zipfian distribution, in which key i (from 0) is chosen with a
+// probability proportional to 1 / (i + 1)^theta, using the algorithm of Gray et al., "Quickly Generating
+// Billion-Record Synthetic Databases" (as YCSB does).
+type zipfianChooser struct {
+	n int
+	theta float64
+	alpha float64
+	zetan float64
+	eta float64
+}
+
+func newZipfianChooser(n int, theta float64) *zipfianChooser {
+	zeta := func(n int) float64 {
+		var sum float64 = 0
+		for i := 1; i <= n; i++ {
+			sum += 1 / math.Pow(float64(i), theta)
+		}
+		return sum
+	}
+
+	c := &zipfianChooser{
+		n:     n,
+		theta: theta,
+		alpha: 1 / (1 - theta),
+		zetan: zeta(n),
+	}
+	c.eta = (1 - math.Pow(2 / float64(n), 1 - theta)) / (1 - zeta(2) / c.zetan)
+	return c
+}
+
+func (c *zipfianChooser) next(rng *rand.Rand) int {
+	u := rng.Float64()
+	uz := u * c.zetan
+	if uz < 1 {
+		return 0
+	}
+	if uz < 1 + math.Pow(0.5, c.theta) {
+		return 1
+	}
+	i := int(float64(c.n) * math.Pow(c.eta * u - c.eta + 1, c.alpha))
+	if i >= c.n {
+		i = c.n - 1
+	}
+	return i
+}
+
+// newWorkload parses the mix of operations (e.g. "get=80,put=10,head=5,list=3,delete=2") and creates a
+// workload that chooses keys among numKeys keys with the key distribution (uniform, zipfian or hotspot).
+func newWorkload(mix string, keyDistribution string, numKeys int) (*workload, error) {
+
+	if len(mix) == 0 {
+		mix = defaultMix
+	}
+	weights := make(map[string]float64)
+	for _, entry := range strings.Split(mix, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid mix: %s", mix)
+		}
+		operation := strings.ToLower(strings.TrimSpace(parts[0]))
+		if !isMixedOperation(operation) {
+			return nil, fmt.Errorf("invalid mix operation: %s", operation)
+		}
+		weight, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("invalid mix weight: %s", entry)
+		}
+		weights[operation] += weight
+	}
+
+	w := &workload{}
+	var total float64 = 0
+	for _, operation := range mixedOperations {
+		if weights[operation] > 0 {
+			total += weights[operation]
+			w.operations = append(w.operations, operation)
+			w.cumWeights = append(w.cumWeights, total)
+		}
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("invalid mix: %s", mix)
+	}
+
+	if numKeys < 1 {
+		return nil, fmt.Errorf("invalid numKeys: %d", numKeys)
+	}
+	w.distribution = strings.ToUpper(keyDistribution)
+	if len(w.distribution) == 0 {
+		w.distribution = keyDistributionUniform
+	}
+	switch w.distribution {
+	case keyDistributionUniform:
+		w.keys = &uniformChooser{n: numKeys}
+	case keyDistributionZipfian:
+		if numKeys == 1 {
+			w.keys = &uniformChooser{n: numKeys}
+		} else {
+			w.keys = newZipfianChooser(numKeys, zipfianConstant)
+		}
+	case keyDistributionHotspot:
+		hot := int(math.Ceil(float64(numKeys) * hotsetFraction))
+		w.keys = &hotspotChooser{n: numKeys, hot: hot}
+	default:
+		return nil, fmt.Errorf("invalid keyDistribution: %s", keyDistribution)
+	}
+	return w, nil
+}
+
+// String returns the mix of operations of the workload, with their weights as percentages.
+func (w *workload) String() string {
+	total := w.cumWeights[len(w.cumWeights) - 1]
+	mix := make([]string, len(w.operations))
+	prev := 0.0
+	for i, operation := range w.operations {
+		mix[i] = fmt.Sprintf("%s=%g", operation, math.Round((w.cumWeights[i] - prev) / total * 10000) / 100)
+		prev = w.cumWeights[i]
+	}
+	return strings.Join(mix, ",")
+}
+
+// nextOperation chooses the operation of the next request, with a probability proportional to its weight,
+// drawing from rng.
+func (w *workload) nextOperation(rng *rand.Rand) string {
+	r := rng.Float64() * w.cumWeights[len(w.cumWeights) - 1]
+	return w.operations[sort.SearchFloat64s(w.cumWeights, r)]
+}
+
+// opRand returns a generator seeded with the seed of the run and the index of an op, so that the draws of the
+// op are the same for every target whatever the ordering.
+func opRand(seed int64, i int) *rand.Rand {
+	return rand.New(&splitMix64{state: uint64(seed) ^ uint64(i) * 0x9e3779b97f4a7c15})
+}
+
+// splitMix64 is the SplitMix64 generator, a rand.Source that is cheap to create for each op.
+type splitMix64 struct {
+	state uint64
+}
+
+func (s *splitMix64) Seed(seed int64) {
+	s.state = uint64(seed)
+}
+
+func (s *splitMix64) Uint64() uint64 {
+	s.state += 0x9e3779b97f4a7c15
+	z := s.state
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+func (s *splitMix64) Int63() int64 {
+	return int64(s.Uint64() >> 1)
+}
+
+// isMixedOperation returns whether the operation is an operation of a mixed workload.
+func isMixedOperation(operation string) bool {
+	for _, mixedOperation := range mixedOperations {
+		if operation == mixedOperation {
+			return true
+		}
+	}
+	return false
+}
+
+// mixedPerf measures the performance (latency, throughput) of Bolt / S3 under a mixed workload.
+func (p *BoltS3Perf) mixedPerf(bucket string) (map[string]interface{}, error) {
+
+	// Run the mixed workload against S3 and Bolt.
+	runs, err := p.mixedRun(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	mixedPerfRespMap := make(map[string]interface{})
+	mixedPerfRespMap["s3_mixed_perf_stats"] = p.mixedStats(runs[0])
+	mixedPerfRespMap["bolt_mixed_perf_stats"] = p.mixedStats(runs[1])
+	mixedPerfRespMap["mixed_comparison"] = p.mixedComparison(runs[0], runs[1])
+	return mixedPerfRespMap, nil
+}
+
+// mixedRun uploads an object for each key to S3 and Bolt, and runs the mixed workload against them,
+// interleaving the operations. The operation, key, and the size and data of uploads of each op are drawn once for
+// its index, so that S3 and Bolt run the same operation on the same key. Delete operations delete an object
+// uploaded (unmeasured) for that purpose before the run, so that the objects read by the other operations remain
+// available; if a duration is set, delete operations beyond the numOps ops of the run (and warmup) upload their
+// object first. The uploaded objects are deleted with the other objects of the run by the cleanup of the run.
+func (p *BoltS3Perf) mixedRun(bucket string) ([]*targetRun, error) {
+
+	keysSeed := time.Now().UnixNano()
+	seed := rand.Int63()
+	n := p.numOps()
+
+	// the objects deleted by the delete operations of the run and of its warmup (indexes from n).
+	var deletes []mixedDelete
+	for i := 0; i < n + p.warmup; i++ {
+		if d, ok := p.mixedDelete(seed, i); ok {
+			deletes = append(deletes, d)
+		}
+	}
+	deleteKeys := make([]string, len(deletes))
+	for j, d := range deletes {
+		deleteKeys[j] = d.key
+	}
+
+	// uploaded objects that are yet to be deleted, of each target.
+	uploaded := make(map[*s3.S3]*sync.Map)
+	for _, svc := range p.targets() {
+		svc := svc
+		if err := forEachKey(p.keys, p.concurrency, func(i int, key string) error {
+			rng := opRand(keysSeed, i)
+			_, err := p.putObject(svc, bucket, key, p.sizes.next(rng), rng.Int63())
+			return err
+		}); err != nil {
+			return nil, err
+		}
+
+		uploaded[svc] = &sync.Map{}
+		if err := forEachKey(deleteKeys, p.concurrency, func(j int, key string) error {
+			if _, err := p.putObject(svc, bucket, key, deletes[j].size, deletes[j].seed); err != nil {
+				return err
+			}
+			uploaded[svc].Store(key, true)
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	return p.runTargets("mixed", p.targets(), n, p.warmup, func(svc *s3.S3, i int) (opResult, error) {
+
+		rng := opRand(seed, i)
+		operation := p.workload.nextOperation(rng)
+		key := p.keys[p.workload.keys.next(rng)]
+		if operation == "delete" {
+			d, _ := p.mixedDelete(seed, i)
+			if _, ok := uploaded[svc].LoadAndDelete(d.key); !ok {
+				if _, err := p.putObject(svc, bucket, d.key, d.size, d.seed); err != nil {
+					return opResult{operation: "delete_object", key: d.key}, err
+				}
+			}
+			key = d.key
+		}
+		return p.mixedOperation(svc, bucket, operation, key, rng)
+	})
+}
+
+// mixedDelete is an object uploaded to be deleted by a delete operation of a mixed workload.
+type mixedDelete struct {
+	key string
+	size int64
+	seed int64
+}
+
+// mixedDelete returns the object deleted by the op of index i, drawn from the seed of the run, and whether the
+// op is a delete operation.
+func (p *BoltS3Perf) mixedDelete(seed int64, i int) (mixedDelete, bool) {
+
+	rng := opRand(seed, i)
+	if p.workload.nextOperation(rng) != "delete" {
+		return mixedDelete{}, false
+	}
+	key := p.keys[p.workload.keys.next(rng)]
+	return mixedDelete{
+		key:  fmt.Sprintf("%s-delete-%d", key, i),
+		size: p.sizes.next(rng),
+		seed: rng.Int63(),
+	}, true
+}
+
+// mixedStats computes the perf stats of each operation of a mixed workload run, and of all operations.
+func (p *BoltS3Perf) mixedStats(run *targetRun) map[string]interface{} {
+
+	mixedPerfStats := make(map[string]interface{})
+	for operation, opResults := range run.results.operations {
+		opPerfStats := p.computePerfStats(opResults, operation == "list_objects_v2",
+			operation == "get_object" || operation == "put_object")
+		p.computeThroughput(opPerfStats, opResults, run.elapsed)
+		mixedPerfStats[operation] = p.output(opPerfStats)
+	}
+	mixedPerfStats["all"] = p.output(p.runStats(run, false, false))
+	return mixedPerfStats
+}
+
+// mixedComparison compares the latency of Bolt with that of S3 for each operation of a mixed workload run, and
+// for all operations.
+func (p *BoltS3Perf) mixedComparison(s3Run *targetRun, boltRun *targetRun) map[string]interface{} {
+
+	mixedComparison := make(map[string]interface{})
+	for operation, boltResults := range boltRun.results.operations {
+		if s3Results, ok := s3Run.results.operations[operation]; ok {
+			mixedComparison[operation] = p.outputComparison(compareLatency(s3Results.latency, boltResults.latency))
+		}
+	}
+	mixedComparison["all"] = p.outputComparison(compareRuns(s3Run, boltRun))
+	return mixedComparison
+}
+
+// mixedOperation sends a single request of a mixed workload and measures it. The size and data of uploads are
+// drawn from rng.
+func (p *BoltS3Perf) mixedOperation(svc *s3.S3, bucket string, operation string, key string,
+	rng *rand.Rand) (opResult, error) {
+
+	result := opResult{key: key}
+	var err error
+	switch operation {
+	case "get":
+		result.operation = "get_object"
+		req, output := svc.GetObjectRequest(&s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+		req.HTTPRequest.Header.Set("Accept-Encoding", "gzip")
+		result.start = time.Now()
+		if err = send(req, &result); err == nil {
+			// read all data from the stream.
+			_, err = io.Copy(ioutil.Discard, output.Body)
+			output.Body.Close()
+			result.bytes = *output.ContentLength
+		}
+	case "put":
+		result, err = p.putObject(svc, bucket, key, p.sizes.next(rng), rng.Int63())
+		result.operation = "put_object"
+		return result, err
+	case "head":
+		result.operation = "head_object"
+		req, _ := svc.HeadObjectRequest(&s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+		result.start = time.Now()
+		err = send(req, &result)
+	case "list":
+		result.operation = "list_objects_v2"
+		result.key = ""
+		req, output := svc.ListObjectsV2Request(&s3.ListObjectsV2Input{
+			Bucket:  aws.String(bucket),
+			MaxKeys: aws.Int64(int64(p.numKeys)),
+		})
+		result.start = time.Now()
+		if err = send(req, &result); err == nil {
+			result.objects = *output.KeyCount
+		}
+	case "delete":
+		result.operation = "delete_object"
+		req, _ := svc.DeleteObjectRequest(&s3.DeleteObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+		result.start = time.Now()
+		err = send(req, &result)
+	}
+
+	// calc latency
+	result.latency = time.Since(result.start)
+	return result, err
+}
+
+// forEachKey calls fn for each key, with its index, from concurrency goroutines, and returns the first error.
+func forEachKey(keys []string, concurrency int, fn func(i int, key string) error) error {
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	indexes := make(chan int)
+	var errOnce sync.Once
+	var firstErr error
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if err := fn(i, keys[i]); err != nil {
+					errOnce.Do(func() { firstErr = err })
+				}
+			}
+		}()
+	}
+	for i := range keys {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return firstErr
+}
@@ -0,0 +1,227 @@
+package bolts3perf
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Offset patterns of the ranges read by the get object range perf test.
+const (
+	// the first rangeSize bytes of each object.
+	rangeOffsetStart = "START"
+	// the last rangeSize bytes of each object, e.g. the footer of a Parquet file.
+	rangeOffsetEnd = "END"
+	// rangeSize bytes at a random offset of each object.
+	rangeOffsetRandom = "RANDOM"
+	// successive ranges of each object, one per iteration, wrapping around at the end of the object.
+	rangeOffsetSequential = "SEQUENTIAL"
+)
+
+// defaultRangeSize is the size of the ranges read by the get object range perf test by default.
+const defaultRangeSize = 64 << 10
+
+// objectSizes caches the sizes of the objects of the keys, as listed or, if the keys were read from a manifest,
+// as returned by a head object request.
+type objectSizes struct {
+	mu sync.Mutex
+	sizes map[string]int64
+}
+
+func (c *objectSizes) get(key string) (int64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	size, ok := c.sizes[key]
+	return size, ok
+}
+
+func (c *objectSizes) set(key string, size int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.sizes == nil {
+		c.sizes = make(map[string]int64)
+	}
+	c.sizes[key] = size
+}
+
+// headObjectPerf measures the Head Object performance (latency, throughput) of Bolt / S3.
+func (p *BoltS3Perf) headObjectPerf(bucket string) (map[string]interface{}, error) {
+
+	// Get the metadata of the object of each key, numIter times, from S3 and Bolt.
+	runs, err := p.runTargets("head_object", p.targets(), p.numOps(), p.warmup, func(svc *s3.S3,
+		i int) (opResult, error) {
+		return p.headObject(svc, bucket, p.keys[i % len(p.keys)])
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	headObjPerfRespMap := make(map[string]interface{})
+	headObjPerfRespMap["s3_head_obj_perf_stats"] = p.output(p.runStats(runs[0], false, false))
+	headObjPerfRespMap["bolt_head_obj_perf_stats"] = p.output(p.runStats(runs[1], false, false))
+	headObjPerfRespMap["head_obj_comparison"] = p.outputComparison(compareRuns(runs[0], runs[1]))
+	return headObjPerfRespMap, nil
+}
+
+// headObject gets the metadata of the object of the key from the given Bolt / S3 client and measures the
+// request.
+func (p *BoltS3Perf) headObject(svc *s3.S3, bucket string, key string) (opResult, error) {
+
+	req, _ := svc.HeadObjectRequest(&s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key: aws.String(key),
+	})
+
+	result := opResult{key: key, start: time.Now()}
+	err := send(req, &result)
+
+	// calc latency
+	result.latency = time.Since(result.start)
+	return result, err
+}
+
+// copyObjectPerf measures the Copy Object performance (latency, throughput) of Bolt / S3.
+func (p *BoltS3Perf) copyObjectPerf(bucket string) (map[string]interface{}, error) {
+
+	// Copy the object of each key, numIter times, in S3 and Bolt.
+	runs, err := p.runTargets("copy_object", p.targets(), p.numOps(), p.warmup, func(svc *s3.S3,
+		i int) (opResult, error) {
+		return p.copyObject(svc, bucket, i % len(p.keys))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// calc perf stats, with the sizes of the copied objects if they were listed.
+	s3CopyObjPerfStats := p.runStats(runs[0], false, runs[0].results.totalBytes > 0)
+	boltCopyObjPerfStats := p.runStats(runs[1], false, runs[1].results.totalBytes > 0)
+
+	copyObjPerfRespMap := make(map[string]interface{})
+	copyObjPerfRespMap["s3_copy_obj_perf_stats"] = p.output(s3CopyObjPerfStats)
+	copyObjPerfRespMap["bolt_copy_obj_perf_stats"] = p.output(boltCopyObjPerfStats)
+	copyObjPerfRespMap["copy_obj_comparison"] = p.outputComparison(compareRuns(runs[0], runs[1]))
+	return copyObjPerfRespMap, nil
+}
+
+// copyObject copies the object of the k-th key to a key under the run prefix (in the same bucket) with the
+// given Bolt / S3 client, and measures the request. The copies are deleted with the other objects of the run.
+func (p *BoltS3Perf) copyObject(svc *s3.S3, bucket string, k int) (opResult, error) {
+
+	key := p.keys[k]
+	req, _ := svc.CopyObjectRequest(&s3.CopyObjectInput{
+		Bucket: aws.String(bucket),
+		Key: aws.String(p.runPrefix + "copy" + strconv.Itoa(k)),
+		CopySource: aws.String(copySource(bucket, key)),
+	})
+
+	result := opResult{key: key, start: time.Now()}
+	err := send(req, &result)
+
+	// calc latency
+	result.latency = time.Since(result.start)
+	if size, ok := p.objectSizes.get(key); ok {
+		result.bytes = size
+	}
+	return result, err
+}
+
+// copySource returns the URL encoded copy source of the object, i.e. <bucket>/<key>.
+func copySource(bucket string, key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return bucket + "/" + strings.Join(segments, "/")
+}
+
+// getObjectRangePerf measures the Get Object (byte range) performance (latency, throughput) of Bolt / S3.
+func (p *BoltS3Perf) getObjectRangePerf(bucket string) (map[string]interface{}, error) {
+
+	// Get a range of the object of each key, numIter times, from S3 and Bolt.
+	runs, err := p.runTargets("get_object_range", p.targets(), p.numOps(), p.warmup, func(svc *s3.S3,
+		i int) (opResult, error) {
+		return p.getObjectRange(svc, bucket, p.keys[i % len(p.keys)], i / len(p.keys))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	getObjRangePerfRespMap := make(map[string]interface{})
+	getObjRangePerfRespMap["s3_get_obj_range_perf_stats"] = p.output(p.runStats(runs[0], false, true))
+	getObjRangePerfRespMap["bolt_get_obj_range_perf_stats"] = p.output(p.runStats(runs[1], false, true))
+	getObjRangePerfRespMap["get_obj_range_comparison"] = p.outputComparison(compareRuns(runs[0], runs[1]))
+	return getObjRangePerfRespMap, nil
+}
+
+// getObjectRange gets a range of rangeSize bytes of the object of the key from the given Bolt / S3 client,
+// reading the entire range, and measures the request. The offset of the range of the iteration-th read of the
+// object follows the range offset pattern.
+func (p *BoltS3Perf) getObjectRange(svc *s3.S3, bucket string, key string, iteration int) (opResult, error) {
+
+	byteRange, err := p.objectRange(svc, bucket, key, iteration)
+	if err != nil {
+		return opResult{key: key}, err
+	}
+
+	req, output := svc.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key: aws.String(key),
+		Range: aws.String(byteRange),
+	})
+	result := opResult{key: key, start: time.Now()}
+	if err := send(req, &result); err != nil {
+		result.latency = time.Since(result.start)
+		return result, err
+	}
+
+	// read the entire range.
+	result.bytes, err = io.Copy(ioutil.Discard, output.Body)
+	output.Body.Close()
+
+	// calc latency
+	result.latency = time.Since(result.start)
+	return result, err
+}
+
+// objectRange returns the HTTP range of the iteration-th read of the object of the key, following the range
+// offset pattern. The size of the object is needed for random and sequential offsets: if the object was not
+// listed, it is retrieved with an (unmeasured) head object request.
+func (p *BoltS3Perf) objectRange(svc *s3.S3, bucket string, key string, iteration int) (string, error) {
+
+	switch p.rangeOffset {
+	case rangeOffsetStart:
+		return fmt.Sprintf("bytes=0-%d", p.rangeSize - 1), nil
+	case rangeOffsetEnd:
+		return fmt.Sprintf("bytes=-%d", p.rangeSize), nil
+	}
+
+	size, ok := p.objectSizes.get(key)
+	if !ok {
+		output, err := svc.HeadObject(&s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+		if err != nil {
+			return "", err
+		}
+		size = aws.Int64Value(output.ContentLength)
+		p.objectSizes.set(key, size)
+	}
+
+	var offset int64
+	if size > p.rangeSize {
+		if p.rangeOffset == rangeOffsetRandom {
+			offset = rand.Int63n(size - p.rangeSize + 1)
+		} else {
+			// successive ranges, starting over once the end of the object is reached.
+			numRanges := (size + p.rangeSize - 1) / p.rangeSize
+			offset = int64(iteration) % numRanges * p.rangeSize
+		}
+	}
+	return fmt.Sprintf("bytes=%d-%d", offset, offset + p.rangeSize - 1), nil
+}
@@ -0,0 +1,47 @@
+package bolts3perf
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Ordering strategies of the requests of a perf test against S3 and Bolt.
+const (
+	// all requests against S3, then all requests against Bolt.
+	orderingSequential = "SEQUENTIAL"
+	// each request against S3 and Bolt, one after the other, alternating which target goes first.
+	orderingAlternating = "ALTERNATING"
+	// each request against S3 and Bolt, one after the other, in random order.
+	orderingRandom = "RANDOM"
+)
+
+// targetOrder chooses the order in which each op is run against the targets of a run.
+type targetOrder struct {
+	ordering string
+	numTargets int
+	rand *rand.Rand
+}
+
+func newTargetOrder(ordering string, numTargets int) *targetOrder {
+	return &targetOrder{
+		ordering:   ordering,
+		numTargets: numTargets,
+		rand:       rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// next returns the indexes of the targets, in the order in which the i-th op is run against them: in index
+// order, rotated by i in alternating ordering, or shuffled in random ordering.
+func (o *targetOrder) next(i int) []int {
+	if o.ordering == orderingRandom {
+		return o.rand.Perm(o.numTargets)
+	}
+	order := make([]int, o.numTargets)
+	for t := range order {
+		order[t] = t
+		if o.ordering == orderingAlternating {
+			order[t] = (t + i) % o.numTargets
+		}
+	}
+	return order
+}
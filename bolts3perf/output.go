@@ -0,0 +1,327 @@
+package bolts3perf
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Output formats of the perf stats. Numeric stats are returned as numbers with unit metadata, text stats as
+// formatted strings (e.g. "12 ms").
+const (
+	outputFormatNumeric = "NUMERIC"
+	outputFormatText = "TEXT"
+)
+
+// Metric is a numeric value and its unit.
+type Metric struct {
+	Value float64 `json:"value"`
+	Unit string `json:"unit"`
+}
+
+// NumericPerfStats holds the perf stats of a test as numbers. It is the numeric counterpart of PerfStats.
+type NumericPerfStats struct {
+	Latency *NumericPerfStat `json:"latency,omitempty"`
+	// latency measured from the intended start of each request, in target-rate mode.
+	CorrectedLatency *NumericPerfStat `json:"correctedLatency,omitempty"`
+	Throughput *NumericPerfStat `json:"throughput,omitempty"`
+	ThroughputT *Metric `json:"throughputT,omitempty"`
+	ObjectSize *NumericPerfStat `json:"objectSize,omitempty"`
+	// latency of the parts of multipart uploads and parallel downloads, and the throughput of each transfer.
+	PartLatency *NumericPerfStat `json:"partLatency,omitempty"`
+	TransferThroughput *NumericPerfStat `json:"transferThroughput,omitempty"`
+	Concurrency int `json:"concurrency,omitempty"`
+	TargetRate *Metric `json:"targetRate,omitempty"`
+	Elapsed *Metric `json:"elapsed,omitempty"`
+	OpsThroughput *Metric `json:"opsThroughput,omitempty"`
+	BytesThroughput *Metric `json:"bytesThroughput,omitempty"`
+	SizeBuckets []SizeBucketStats `json:"sizeBuckets,omitempty"`
+	// failed requests, in error-tolerant mode. The other stats are those of the successful requests.
+	Errors *NumericErrorStats `json:"errors,omitempty"`
+	Phases *NumericPhaseStats `json:"phases,omitempty"`
+	LatencyHdrHistogram string `json:"latencyHdrHistogram,omitempty"`
+	CorrectedLatencyHdrHistogram string `json:"correctedLatencyHdrHistogram,omitempty"`
+}
+
+// SizeBucketStats is the no. of objects whose size is at most UpperBound bytes (and above the previous bucket's
+// bound) and the throughput of the requests that transferred them, i.e. the no. of MB (10^6 bytes) transferred
+// per second of request latency. The UpperBound of the last bucket is null.
+type SizeBucketStats struct {
+	UpperBound *int64 `json:"le"`
+	Count int64 `json:"count"`
+	Bytes int64 `json:"bytes"`
+	Throughput *Metric `json:"throughput"`
+}
+
+// NumericPhaseStats holds the latency stats of each phase of the requests, measured with httptrace. DNS,
+// Connect and TLS only count the requests that opened a new connection. It is the numeric counterpart of
+// PhaseStats.
+type NumericPhaseStats struct {
+	DNS *NumericPerfStat `json:"dns,omitempty"`
+	Connect *NumericPerfStat `json:"connect,omitempty"`
+	TLS *NumericPerfStat `json:"tls,omitempty"`
+	Write *NumericPerfStat `json:"write,omitempty"`
+	FirstByte *NumericPerfStat `json:"firstByte,omitempty"`
+	Transfer *NumericPerfStat `json:"transfer,omitempty"`
+}
+
+// NumericErrorStats is the no. of requests of an error-tolerant test, the no. and the rate (%) of failed
+// requests, and the no. of failed requests of each error code and HTTP status. It is the numeric counterpart
+// of ErrorStats.
+type NumericErrorStats struct {
+	Requests int64 `json:"requests"`
+	Failed int64 `json:"failed"`
+	Rate *Metric `json:"rate"`
+	Breakdown []ErrorCount `json:"breakdown,omitempty"`
+}
+
+// ErrorCount is the no. of failed requests with an error code and HTTP status (0 if there was no response),
+// with the message of the first one.
+type ErrorCount struct {
+	Code string `json:"code"`
+	Status int `json:"status"`
+	Count int64 `json:"count"`
+	Message string `json:"message,omitempty"`
+}
+
+// NumericPerfStat holds summary statistics, all in the same unit, as numbers. It is the numeric counterpart
+// of PerfStat.
+type NumericPerfStat struct {
+	Unit string `json:"unit"`
+	Count int `json:"count"`
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+	Average float64 `json:"average"`
+	StdDev float64 `json:"stddev"`
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P95 float64 `json:"p95"`
+	P99 float64 `json:"p99"`
+	P999 float64 `json:"p99.9"`
+	Histogram []NumericHistogramBucket `json:"histogram,omitempty"`
+}
+
+// NumericHistogramBucket is the no. of samples that are at most UpperBound (and above the previous bucket's
+// bound). The UpperBound of the last bucket is null.
+type NumericHistogramBucket struct {
+	UpperBound *float64 `json:"le"`
+	Count int `json:"count"`
+}
+
+// NumericObjectCount is the numeric counterpart of ObjectCount.
+type NumericObjectCount struct {
+	Compressed int64 `json:"compressed"`
+	Uncompressed int64 `json:"uncompressed"`
+}
+
+// RunParams holds the parameters of a perf run, returned along with numeric perf stats.
+type RunParams struct {
+	RequestType string `json:"requestType"`
+	Bucket string `json:"bucket"`
+	RunID string `json:"runId,omitempty"`
+	KeyPrefix string `json:"keyPrefix,omitempty"`
+	NumKeys int `json:"numKeys"`
+	Prefix string `json:"prefix,omitempty"`
+	KeySampling string `json:"keySampling,omitempty"`
+	Manifest string `json:"manifest,omitempty"`
+	RangeSize int64 `json:"rangeSize,omitempty"`
+	RangeOffset string `json:"rangeOffset,omitempty"`
+	PartSize int64 `json:"partSize,omitempty"`
+	PartConcurrency int `json:"partConcurrency,omitempty"`
+	ObjLength int `json:"objLength"`
+	SizeDistribution string `json:"sizeDistribution"`
+	PayloadType string `json:"payloadType"`
+	ContentEncoding string `json:"contentEncoding,omitempty"`
+	ErrorBudget string `json:"errorBudget,omitempty"`
+	NumIter int `json:"numIter,omitempty"`
+	Duration *Metric `json:"duration,omitempty"`
+	Concurrency []int `json:"concurrency"`
+	Rate *Metric `json:"rate,omitempty"`
+	Ordering string `json:"ordering"`
+	Warmup int `json:"warmup,omitempty"`
+	Mix string `json:"mix,omitempty"`
+	KeyDistribution string `json:"keyDistribution,omitempty"`
+	Region string `json:"region"`
+	StartTime time.Time `json:"startTime"`
+	EndTime time.Time `json:"endTime"`
+}
+
+// output returns the perf stats in the output format of the run.
+func (p *BoltS3Perf) output(stats *NumericPerfStats) interface{} {
+	if p.outputFormat == outputFormatText {
+		return stats.text()
+	}
+	return stats
+}
+
+// outputCount returns the object count in the output format of the run.
+func (p *BoltS3Perf) outputCount(count *NumericObjectCount) interface{} {
+	if p.outputFormat == outputFormatText {
+		return &ObjectCount{
+			Compressed:   fmt.Sprintf("%d", count.Compressed),
+			Uncompressed: fmt.Sprintf("%d", count.Uncompressed),
+		}
+	}
+	return count
+}
+
+// outputComparison returns the comparison of Bolt with S3 in the output format of the run.
+func (p *BoltS3Perf) outputComparison(comparison *NumericComparison) interface{} {
+	if p.outputFormat == outputFormatText {
+		return comparison.text()
+	}
+	return comparison
+}
+
+// text formats the perf stats as strings.
+func (s *NumericPerfStats) text() *PerfStats {
+	return &PerfStats{
+		Latency:                      s.Latency.text(),
+		Throughput:                   s.Throughput.text(),
+		ThroughputT:                  s.ThroughputT.text(),
+		ObjectSize:                   s.ObjectSize.text(),
+		CorrectedLatency:             s.CorrectedLatency.text(),
+		PartLatency:                  s.PartLatency.text(),
+		TransferThroughput:           s.TransferThroughput.text(),
+		Concurrency:                  s.Concurrency,
+		TargetRate:                   s.TargetRate.text(),
+		OpsThroughput:                s.OpsThroughput.text(),
+		BytesThroughput:              s.BytesThroughput.text(),
+		SizeBuckets:                  sizeBucketsText(s.SizeBuckets),
+		Errors:                       s.Errors.text(),
+		Phases:                       s.Phases.text(),
+		LatencyHdrHistogram:          s.LatencyHdrHistogram,
+		CorrectedLatencyHdrHistogram: s.CorrectedLatencyHdrHistogram,
+	}
+}
+
+// text formats the summary statistics as strings, as the original text format did: averages with 2 decimals
+// (e.g. "12.34 ms"), and percentiles of latencies and object sizes as whole numbers (e.g. "12 ms").
+func (s *NumericPerfStat) text() *PerfStat {
+	if s == nil {
+		return nil
+	}
+
+	format := "%.2f " + strings.ReplaceAll(s.Unit, "%", "%%")
+	valueFormat := format
+	if s.Unit == "ms" || s.Unit == "bytes" {
+		valueFormat = "%.0f " + s.Unit
+	}
+	perfStat := &PerfStat{
+		Average: fmt.Sprintf(format, s.Average),
+		P50:     fmt.Sprintf(valueFormat, s.P50),
+		P90:     fmt.Sprintf(valueFormat, s.P90),
+		Count:   s.Count,
+		Min:     fmt.Sprintf(valueFormat, s.Min),
+		Max:     fmt.Sprintf(valueFormat, s.Max),
+		StdDev:  fmt.Sprintf(format, s.StdDev),
+		P95:     fmt.Sprintf(valueFormat, s.P95),
+		P99:     fmt.Sprintf(valueFormat, s.P99),
+		P999:    fmt.Sprintf(valueFormat, s.P999),
+	}
+	for _, bucket := range s.Histogram {
+		upperBound := "+Inf"
+		if bucket.UpperBound != nil {
+			upperBound = fmt.Sprintf("%g %s", *bucket.UpperBound, s.Unit)
+		}
+		perfStat.Histogram = append(perfStat.Histogram, HistogramBucket{UpperBound: upperBound, Count: bucket.Count})
+	}
+	return perfStat
+}
+
+// text formats the latency stats of the phases as strings.
+func (s *NumericPhaseStats) text() *PhaseStats {
+	if s == nil {
+		return nil
+	}
+	return &PhaseStats{
+		DNS:       s.DNS.text(),
+		Connect:   s.Connect.text(),
+		TLS:       s.TLS.text(),
+		Write:     s.Write.text(),
+		FirstByte: s.FirstByte.text(),
+		Transfer:  s.Transfer.text(),
+	}
+}
+
+// text formats the error rate as a string, e.g. "1.25 %".
+func (s *NumericErrorStats) text() *ErrorStats {
+	if s == nil {
+		return nil
+	}
+	return &ErrorStats{
+		Requests:  s.Requests,
+		Failed:    s.Failed,
+		Rate:      s.Rate.text(),
+		Breakdown: s.Breakdown,
+	}
+}
+
+// text formats the values of the comparison as strings, e.g. "0.61x (0.58x - 0.65x)" for a ratio.
+func (c *NumericComparison) text() *Comparison {
+	comparison := &Comparison{
+		S3Count:      c.S3Count,
+		BoltCount:    c.BoltCount,
+		Confidence:   fmt.Sprintf("%g%%", c.Confidence * 100),
+		MannWhitneyU: c.MannWhitneyU,
+		Verdict:      c.Verdict,
+		Summary:      c.Summary,
+	}
+	for _, p := range c.Percentiles {
+		comparison.Percentiles = append(comparison.Percentiles, PercentileComparison{
+			Percentile: p.Percentile,
+			S3:         p.S3.text(),
+			Bolt:       p.Bolt.text(),
+			Ratio:      p.Ratio.text(),
+			Difference: p.Difference.text(),
+		})
+	}
+	return comparison
+}
+
+// text formats the estimate and its confidence interval as a string, e.g. "-7.800 ms (-8.100 ms - -7.500 ms)",
+// or "0.61x (0.58x - 0.65x)" for a ratio.
+func (e *Estimate) text() string {
+	if e == nil {
+		return ""
+	}
+	format := "%.2fx"
+	if len(e.Unit) > 0 {
+		format = textFormat(e.Unit)
+	}
+	return fmt.Sprintf(format + " (" + format + " - " + format + ")", e.Value, e.Low, e.High)
+}
+
+// text formats the metric as a string, e.g. "12.34 ops/s".
+func (m *Metric) text() string {
+	if m == nil {
+		return ""
+	}
+	return fmt.Sprintf(textFormat(m.Unit), m.Value)
+}
+
+// textFormat returns the format of values of the unit: latencies with microsecond precision, others with
+// 2 decimals.
+func textFormat(unit string) string {
+	if unit == "ms" {
+		return "%.3f ms"
+	}
+	return "%.2f " + strings.ReplaceAll(unit, "%", "%%")
+}
+
+// sizeBucketsText formats the size bucket stats as strings.
+func sizeBucketsText(sizeBuckets []SizeBucketStats) []SizeBucket {
+	var buckets []SizeBucket
+	for _, bucket := range sizeBuckets {
+		upperBound := "+Inf"
+		if bucket.UpperBound != nil {
+			upperBound = fmt.Sprintf("%d bytes", *bucket.UpperBound)
+		}
+		buckets = append(buckets, SizeBucket{
+			UpperBound: upperBound,
+			Count:      bucket.Count,
+			Throughput: bucket.Throughput.text(),
+		})
+	}
+	return buckets
+}
@@ -0,0 +1,402 @@
+package bolts3perf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// payloadBlockSize is the size of the blocks in which payload data is generated.
+const payloadBlockSize = 64 << 10
+
+// payloadLetters are the characters of alphanumeric payload data.
+const payloadLetters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// parquetMagic is the magic number at the start and the end of a Parquet file.
+const parquetMagic = "PAR1"
+
+// Payload types.
+const (
+	payloadAlphanumeric = "ALPHANUMERIC"
+	payloadRandom = "RANDOM"
+	payloadCompressible = "COMPRESSIBLE"
+	payloadJSON = "JSON"
+	payloadCSV = "CSV"
+	payloadParquet = "PARQUET"
+)
+
+// payloadGenerator fills the blocks of a payload with data. The data of a block only depends on the block index
+// and on the random numbers it draws from rnd.
+type payloadGenerator interface {
+	fill(b []byte, index int64, rnd *blockRand)
+	String() string
+}
+
+// payload is the synthetic data of an object, which is generated as it is read instead of being held in
+// memory. The data of each block is derived from the seed and the block index, so that the payload can be
+// re-read after seeking (e.g. to sign the request, or to retry it) and read concurrently at different offsets
+// (e.g. to upload the parts of a multipart upload).
+type payload struct {
+	size int64
+	seed uint64
+	generator payloadGenerator
+	offset int64
+	// last generated block, which is re-used by consecutive reads of the block.
+	mu sync.Mutex
+	blockIndex int64
+	block []byte
+}
+
+// newPayload returns a payload of size bytes generated from the seed.
+func newPayload(size int64, seed int64, generator payloadGenerator) *payload {
+	return &payload{size: size, seed: uint64(seed), generator: generator, blockIndex: -1}
+}
+
+// Read reads the data at the current offset.
+func (p *payload) Read(b []byte) (int, error) {
+	n, err := p.ReadAt(b, p.offset)
+	p.offset += int64(n)
+	return n, err
+}
+
+// ReadAt reads the data at the given offset.
+func (p *payload) ReadAt(b []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("payload: negative offset")
+	}
+	if off >= p.size {
+		return 0, io.EOF
+	}
+	n := len(b)
+	if int64(n) > p.size - off {
+		n = int(p.size - off)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for read := 0; read < n; {
+		pos := off + int64(read)
+		index := pos / payloadBlockSize
+		if index != p.blockIndex {
+			p.generateBlock(index)
+		}
+		read += copy(b[read:n], p.block[pos - index * payloadBlockSize:])
+	}
+
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// generateBlock generates the data of the block with the given index.
+func (p *payload) generateBlock(index int64) {
+	length := int64(payloadBlockSize)
+	if remaining := p.size - index * payloadBlockSize; remaining < length {
+		length = remaining
+	}
+	if p.block == nil {
+		p.block = make([]byte, payloadBlockSize)
+	}
+	p.block = p.block[:length]
+	p.generator.fill(p.block, index, &blockRand{state: splitmix64(p.seed ^ uint64(index))})
+
+	// Parquet files end with the magic number.
+	if _, ok := p.generator.(*parquetGenerator); ok && index * payloadBlockSize + length == p.size &&
+		p.size >= 2 * int64(len(parquetMagic)) {
+		copy(p.block[length - int64(len(parquetMagic)):], parquetMagic)
+	}
+	p.blockIndex = index
+}
+
+// Seek sets the offset of the next Read.
+func (p *payload) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += p.offset
+	case io.SeekEnd:
+		offset += p.size
+	default:
+		return 0, errors.New("payload: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("payload: negative offset")
+	}
+	p.offset = offset
+	return offset, nil
+}
+
+// parsePayloadType parses the type of generated payload data:
+// 1) alphanumeric - random alphanumeric characters (default)
+// 2) random - random bytes
+// 3) compressible:<ratio> - random bytes followed by a repeated pattern in each 4 KiB chunk, in proportions
+//    that make the data compress by about the given ratio (e.g. 4 for 4:1)
+// 4) json - synthetic JSON log lines
+// 5) csv - synthetic CSV log lines, with a header line
+// 6) parquet - Parquet-like binary data: column chunks of delta encoded integers, dictionary indexes,
+//    floating point values and strings, between Parquet magic numbers
+func parsePayloadType(s string) (payloadGenerator, error) {
+
+	parts := strings.SplitN(s, ":", 2)
+	switch strings.ToUpper(strings.TrimSpace(parts[0])) {
+	case "", payloadAlphanumeric:
+		return &alphanumericGenerator{}, nil
+	case payloadRandom:
+		return &randomGenerator{}, nil
+	case payloadCompressible:
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid payloadType: %s (compressible:<ratio>)", s)
+		}
+		ratio, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if err != nil || ratio < 1 {
+			return nil, fmt.Errorf("invalid payloadType: %s (ratio must be at least 1)", s)
+		}
+		return &compressibleGenerator{ratio: ratio}, nil
+	case payloadJSON:
+		return &logGenerator{csv: false}, nil
+	case payloadCSV:
+		return &logGenerator{csv: true}, nil
+	case payloadParquet:
+		return &parquetGenerator{}, nil
+	default:
+		return nil, fmt.Errorf("invalid payloadType: %s", s)
+	}
+}
+
+// alphanumericGenerator generates random alphanumeric characters.
+type alphanumericGenerator struct{}
+
+func (g *alphanumericGenerator) fill(b []byte, index int64, rnd *blockRand) {
+	for i := range b {
+		b[i] = payloadLetters[rnd.intn(len(payloadLetters))]
+	}
+}
+
+func (g *alphanumericGenerator) String() string {
+	return "alphanumeric"
+}
+
+// randomGenerator generates random bytes, which are not compressible.
+type randomGenerator struct{}
+
+func (g *randomGenerator) fill(b []byte, index int64, rnd *blockRand) {
+	rnd.read(b)
+}
+
+func (g *randomGenerator) String() string {
+	return "random"
+}
+
+// compressibleGenerator generates chunks made of random bytes followed by a repeated pattern. Only the random
+// bytes remain after compression, so that the data compresses by about the ratio of the chunk size to the no.
+// of random bytes.
+type compressibleGenerator struct {
+	ratio float64
+}
+
+// compressibleChunkSize is the size of the chunks of compressible payload data.
+const compressibleChunkSize = 4 << 10
+
+func (g *compressibleGenerator) fill(b []byte, index int64, rnd *blockRand) {
+	randomLength := int(math.Round(compressibleChunkSize / g.ratio))
+	for chunk := 0; chunk < len(b); chunk += compressibleChunkSize {
+		end := chunk + compressibleChunkSize
+		if end > len(b) {
+			end = len(b)
+		}
+		split := chunk + randomLength
+		if split > end {
+			split = end
+		}
+		rnd.read(b[chunk:split])
+		for i := split; i < end; i++ {
+			b[i] = payloadLetters[i % len(payloadLetters)]
+		}
+	}
+}
+
+func (g *compressibleGenerator) String() string {
+	return fmt.Sprintf("compressible:%g", g.ratio)
+}
+
+// Values of the fields of synthetic log lines.
+var (
+	logLevels = []string{"INFO", "INFO", "INFO", "INFO", "DEBUG", "WARN", "ERROR"}
+	logServices = []string{"checkout", "catalog", "payments", "search", "auth", "inventory"}
+	logMethods = []string{"GET", "GET", "GET", "POST", "PUT", "DELETE"}
+	logPaths = []string{"/api/v1/orders", "/api/v1/products", "/api/v1/users", "/api/v1/cart", "/health"}
+	logStatuses = []int{200, 200, 200, 200, 201, 204, 304, 400, 404, 500, 503}
+	logMessages = []string{"request completed", "cache miss", "upstream timeout", "retrying request",
+		"validation failed", "session refreshed"}
+)
+
+// logEpoch is the timestamp of the first line of synthetic logs.
+var logEpoch = time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// logGenerator generates synthetic web service log lines, as JSON objects or as CSV records. Each block starts
+// with a new line (CSV data starts with a header line), and the line that does not fit in a block is truncated
+// to end the block with a newline.
+type logGenerator struct {
+	csv bool
+}
+
+func (g *logGenerator) fill(b []byte, index int64, rnd *blockRand) {
+	line := make([]byte, 0, 512)
+	pos := 0
+	if g.csv && index == 0 {
+		pos += copy(b, "timestamp,level,service,host,request_id,method,path,status,latency_ms,bytes,message\n")
+	}
+
+	// lines are about 1 ms apart, starting at a time that depends on the block.
+	ts := logEpoch.Add(time.Duration(index) * time.Minute)
+	for pos < len(b) {
+		ts = ts.Add(time.Duration(rnd.intn(2000)) * time.Microsecond)
+		level := logLevels[rnd.intn(len(logLevels))]
+		service := logServices[rnd.intn(len(logServices))]
+		host := fmt.Sprintf("ip-10-0-%d-%d", rnd.intn(16), rnd.intn(256))
+		requestID := fmt.Sprintf("%016x", rnd.uint64())
+		method := logMethods[rnd.intn(len(logMethods))]
+		path := fmt.Sprintf("%s/%d", logPaths[rnd.intn(len(logPaths))], rnd.intn(100000))
+		status := logStatuses[rnd.intn(len(logStatuses))]
+		latency := float64(rnd.intn(100000)) / 100
+		bytes := rnd.intn(1 << 20)
+		message := logMessages[rnd.intn(len(logMessages))]
+
+		line = line[:0]
+		if g.csv {
+			line = append(line, fmt.Sprintf("%s,%s,%s,%s,%s,%s,%s,%d,%.2f,%d,%s\n",
+				ts.Format("2006-01-02T15:04:05.000Z"), level, service, host, requestID, method, path, status,
+				latency, bytes, message)...)
+		} else {
+			line = append(line, fmt.Sprintf("{\"timestamp\":\"%s\",\"level\":\"%s\",\"service\":\"%s\","+
+				"\"host\":\"%s\",\"requestId\":\"%s\",\"method\":\"%s\",\"path\":\"%s\",\"status\":%d,"+
+				"\"latencyMs\":%.2f,\"bytes\":%d,\"message\":\"%s\"}\n",
+				ts.Format("2006-01-02T15:04:05.000Z"), level, service, host, requestID, method, path, status,
+				latency, bytes, message)...)
+		}
+
+		n := copy(b[pos:], line)
+		pos += n
+		if n < len(line) {
+			b[len(b) - 1] = '\n'
+		}
+	}
+}
+
+func (g *logGenerator) String() string {
+	if g.csv {
+		return "csv"
+	}
+	return "json"
+}
+
+// parquetGenerator generates Parquet-like binary data: each block is a column chunk with a page header,
+// followed by delta encoded sorted integers, run-length encoded dictionary indexes, a random walk of floating
+// point values and dictionary strings, as found in columnar files. The data starts and ends with the Parquet
+// magic number.
+type parquetGenerator struct{}
+
+func (g *parquetGenerator) fill(b []byte, index int64, rnd *blockRand) {
+	pos := 0
+	if index == 0 {
+		pos += copy(b, parquetMagic)
+	}
+
+	// page header: page type, uncompressed and compressed sizes, no. of values (thrift-like varints).
+	var header [32]byte
+	n := binary.PutUvarint(header[:], 0)
+	n += binary.PutUvarint(header[n:], uint64(len(b)))
+	n += binary.PutUvarint(header[n:], uint64(len(b)))
+	n += binary.PutUvarint(header[n:], uint64(len(b) / 16))
+	pos += copy(b[pos:], header[:n])
+
+	// split the rest of the block between the columns.
+	column := (len(b) - pos) / 4
+
+	// delta encoded sorted integers (e.g. ids, timestamps).
+	end := pos + column
+	var buf [binary.MaxVarintLen64]byte
+	for pos < end {
+		n := binary.PutUvarint(buf[:], uint64(rnd.intn(64)))
+		pos += copy(b[pos:end], buf[:n])
+	}
+
+	// run-length encoded dictionary indexes (e.g. a low cardinality column).
+	end += column
+	for ; pos + 2 <= end; pos += 2 {
+		b[pos] = byte(1 + rnd.intn(32))
+		b[pos + 1] = byte(rnd.intn(16))
+	}
+	for ; pos < end; pos++ {
+		b[pos] = 0
+	}
+
+	// random walk of floating point values (e.g. prices, measurements).
+	end += column
+	value := 100.0
+	for ; pos + 8 <= end; pos += 8 {
+		value += float64(rnd.intn(201) - 100) / 100
+		binary.LittleEndian.PutUint64(b[pos:], math.Float64bits(value))
+	}
+	for ; pos < end; pos++ {
+		b[pos] = 0
+	}
+
+	// dictionary strings, length prefixed.
+	for pos < len(b) {
+		s := logServices[rnd.intn(len(logServices))]
+		if pos + 4 + len(s) > len(b) {
+			for ; pos < len(b); pos++ {
+				b[pos] = 0
+			}
+			break
+		}
+		binary.LittleEndian.PutUint32(b[pos:], uint32(len(s)))
+		pos += 4
+		pos += copy(b[pos:], s)
+	}
+}
+
+func (g *parquetGenerator) String() string {
+	return "parquet"
+}
+
+// blockRand is a fast pseudo-random number generator for the data of a block (SplitMix64).
+type blockRand struct {
+	state uint64
+}
+
+func (r *blockRand) uint64() uint64 {
+	r.state += 0x9e3779b97f4a7c15
+	return splitmix64(r.state)
+}
+
+// intn returns a pseudo-random number in [0, n).
+func (r *blockRand) intn(n int) int {
+	return int(r.uint64() % uint64(n))
+}
+
+// read fills b with pseudo-random bytes.
+func (r *blockRand) read(b []byte) {
+	for i := 0; i < len(b); i += 8 {
+		v := r.uint64()
+		for j := 0; j < 8 && i + j < len(b); j++ {
+			b[i + j] = byte(v >> (8 * uint(j)))
+		}
+	}
+}
+
+// splitmix64 is a fast 64-bit hash function with good statistical properties (SplitMix64).
+func splitmix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
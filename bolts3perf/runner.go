@@ -0,0 +1,448 @@
+package bolts3perf
+
+import (
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"net/http/httptrace"
+	"sort"
+	"sync"
+	"time"
+)
+
+// opResult is the measurement of a single operation.
+type opResult struct {
+	// operation, if the run is made of several kinds of operations.
+	operation string
+	// key of the object, for single object operations.
+	key string
+	// time at which the operation was started.
+	start time.Time
+	// time at which the operation was scheduled to start, in target-rate mode.
+	intended time.Time
+	// latency of the operation, at nanosecond resolution.
+	latency time.Duration
+	// time until the response headers of the operation were received (time to first byte).
+	ttfb time.Duration
+	// HTTP status code of the response.
+	status int
+	// no. of times the request (or the requests of the parts of a transfer) was retried.
+	retries int
+	// no. of bytes transferred by the operation.
+	bytes int64
+	// no. of objects returned by the operation, for operations that return several objects.
+	objects int64
+	// whether the object is gzip encoded.
+	compressed bool
+	// httptrace events of the request, if it was sent with send.
+	trace *requestTrace
+	// latencies of the parts of a multipart upload or parallel download.
+	parts []time.Duration
+}
+
+// Value ranges of the histograms of a recorder, recorded with 3 significant digits.
+const (
+	maxRecordedLatency = int64(time.Hour)
+	maxRecordedObjectSize = int64(5) << 40
+	maxRecordedObjectsTp = int64(1e9)
+	maxRecordedBytesTp = int64(1e12)
+)
+
+// recorder aggregates the results of the operations of a run in HDR histograms, so that its memory footprint
+// does not grow with the length of the run.
+type recorder struct {
+	mu sync.Mutex
+	// latencies in ns.
+	latency *Histogram
+	// latencies in ns measured from the intended start of each operation, in target-rate mode.
+	correctedLatency *Histogram
+	// no. of bytes transferred by each operation.
+	bytes *Histogram
+	// no. of objects per second returned by each operation.
+	objectsTp *Histogram
+	// duration in ns of each phase of the requests (DNS, connect, TLS, write, first byte, transfer).
+	phases [numPhases]*Histogram
+	// latencies in ns of the parts of multipart uploads and parallel downloads, and the no. of bytes per
+	// second transferred by each operation.
+	partLatency *Histogram
+	bytesTp *Histogram
+	count int64
+	totalBytes int64
+	totalLatency time.Duration
+	compressed int64
+	// no. of objects, bytes and total latency in each object size bucket.
+	sizeBuckets []sizeBucketTotals
+	// no. of failed requests, and their no. for each error code and HTTP status, in error-tolerant mode.
+	failed int64
+	errors map[errorKey]*errorTotals
+	// results of each operation, if the run is made of several kinds of operations.
+	operations map[string]*recorder
+}
+
+// sizeBucketTotals sums the results of the operations on objects of a size bucket.
+type sizeBucketTotals struct {
+	count int64
+	bytes int64
+	latency time.Duration
+}
+
+func newRecorder() *recorder {
+	r := &recorder{
+		latency:          NewHistogram(1, maxRecordedLatency, 3),
+		correctedLatency: NewHistogram(1, maxRecordedLatency, 3),
+		bytes:            NewHistogram(1, maxRecordedObjectSize, 3),
+		objectsTp:        NewHistogram(1, maxRecordedObjectsTp, 3),
+		partLatency:      NewHistogram(1, maxRecordedLatency, 3),
+		bytesTp:          NewHistogram(1, maxRecordedBytesTp, 3),
+		sizeBuckets:      make([]sizeBucketTotals, len(sizeBucketBounds) + 1),
+	}
+	for i := range r.phases {
+		r.phases[i] = NewHistogram(1, maxRecordedLatency, 3)
+	}
+	return r
+}
+
+// record adds the result of an operation to the recorder.
+func (r *recorder) record(result opResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(result.operation) > 0 {
+		if r.operations == nil {
+			r.operations = make(map[string]*recorder)
+		}
+		if _, ok := r.operations[result.operation]; !ok {
+			r.operations[result.operation] = newRecorder()
+		}
+		opResult := result
+		opResult.operation = ""
+		r.operations[result.operation].record(opResult)
+	}
+
+	r.count++
+	r.totalLatency += result.latency
+	r.totalBytes += result.bytes
+	r.latency.RecordValue(int64(result.latency))
+	if !result.intended.IsZero() {
+		r.correctedLatency.RecordValue(int64(result.correctedLatency()))
+	}
+	r.bytes.RecordValue(result.bytes)
+	if result.objects > 0 && result.latency > 0 {
+		r.objectsTp.RecordValue(int64(float64(result.objects) / result.latency.Seconds()))
+	}
+	if result.bytes > 0 && result.latency > 0 {
+		r.bytesTp.RecordValue(int64(float64(result.bytes) / result.latency.Seconds()))
+	}
+	for _, latency := range result.parts {
+		r.partLatency.RecordValue(int64(latency))
+	}
+	if result.compressed {
+		r.compressed++
+	}
+	if result.bytes > 0 {
+		b := sort.Search(len(sizeBucketBounds), func(i int) bool { return sizeBucketBounds[i] >= result.bytes })
+		r.sizeBuckets[b].count++
+		r.sizeBuckets[b].bytes += result.bytes
+		r.sizeBuckets[b].latency += result.latency
+	}
+	if result.trace != nil {
+		durations, occurred := result.trace.phases(result.start.Add(result.latency))
+		for i := range durations {
+			if occurred[i] {
+				r.phases[i].RecordValue(int64(durations[i]))
+			}
+		}
+	}
+}
+
+// correctedLatency returns the latency of the operation measured from its intended start, which includes the
+// time the operation was delayed because all workers were busy.
+func (result opResult) correctedLatency() time.Duration {
+	if result.intended.IsZero() || result.start.Before(result.intended) {
+		return result.latency
+	}
+	return result.latency + result.start.Sub(result.intended)
+}
+
+// dispatch is an operation index dispatched to a worker, with the time the operation is scheduled to start in
+// target-rate mode, and the order in which the operation is run against the targets.
+type dispatch struct {
+	i int
+	intended time.Time
+	order []int
+}
+
+// targetRun is the recorded results of the operations of a run against a target (S3 or Bolt), and the
+// wall-clock time taken by the run.
+type targetRun struct {
+	results *recorder
+	elapsed time.Duration
+}
+
+// runTargets runs the operation against each target of svcs, in the order of the ordering strategy, and returns
+// the run of each target. In sequential ordering, all ops are run against a target before the next target (S3
+// before Bolt). Otherwise each op is run against all targets, one after the other, in alternating or random
+// order, so that caching and warm connections do not favor a target; the targets then share the wall-clock time
+// of the run. If warmup is set, warmup ops are run (in the same order) before the ops of the run, and are neither
+// recorded nor exported. Warmup ops are called with the indexes that follow those of the run, in [n, n + warmup),
+// so that ops drawing from their index do not repeat the ops of the run.
+func (p *BoltS3Perf) runTargets(operation string, svcs []*s3.S3, n int, warmup int,
+	op func(svc *s3.S3, i int) (opResult, error)) ([]*targetRun, error) {
+
+	warmupOp := func(svc *s3.S3, i int) (opResult, error) {
+		return op(svc, n + i)
+	}
+
+	runs := make([]*targetRun, len(svcs))
+	if p.ordering == orderingSequential {
+		for t, svc := range svcs {
+			if warmup > 0 {
+				if _, _, err := p.runWorkers(operation, []*s3.S3{svc}, warmup, true, warmupOp); err != nil {
+					return nil, err
+				}
+			}
+			results, elapsed, err := p.runWorkers(operation, []*s3.S3{svc}, n, false, op)
+			if err != nil {
+				return nil, err
+			}
+			runs[t] = &targetRun{results: results[0], elapsed: elapsed}
+		}
+		return runs, nil
+	}
+
+	if warmup > 0 {
+		if _, _, err := p.runWorkers(operation, svcs, warmup, true, warmupOp); err != nil {
+			return nil, err
+		}
+	}
+	results, elapsed, err := p.runWorkers(operation, svcs, n, false, op)
+	if err != nil {
+		return nil, err
+	}
+	for t := range svcs {
+		runs[t] = &targetRun{results: results[t], elapsed: elapsed}
+	}
+	return runs, nil
+}
+
+// runWorkers calls op from a pool of p.concurrency workers and returns the recorded results of the operations
+// against each target of svcs and the wall-clock time taken by the run. op is called for each index in [0, n),
+// or, if a duration is set, with increasing indexes until the duration has elapsed, against each target in the
+// order of the ordering strategy. If a target rate is set, ops are scheduled open-loop at that rate,
+// independently of the completion of earlier ops, and each op is delayed until a worker is free if all workers
+// are busy. No more indexes are dispatched once an op has failed, or once the deadline of the run has passed
+// (ErrRunTimeout), and the first error is returned. In error-tolerant mode, failed ops are counted instead, and
+// the run is only stopped if they exceed the error budget of their target (ErrErrorBudgetExceeded). If records
+// are exported, the result of each op, including failed ones, is exported as a record of the operation against
+// its target. In warmup mode, n ops are run, without duration or target rate, and their results are discarded.
+// With a target rate and alternating or random ordering, an op is scheduled once for all targets: the corrected
+// latency of each target includes the delay of the op (from its scheduled start until a worker started it), but
+// not the duration of the requests to the targets before it, so that no target is penalized by its position.
+func (p *BoltS3Perf) runWorkers(operation string, svcs []*s3.S3, n int, warmup bool,
+	op func(svc *s3.S3, i int) (opResult, error)) ([]*recorder, time.Duration, error) {
+
+	results := make([]*recorder, len(svcs))
+	for t := range results {
+		results[t] = newRecorder()
+	}
+	if n == 0 {
+		return results, 0, nil
+	}
+
+	duration := p.duration
+	rate := p.rate
+	if warmup {
+		duration = 0
+		rate = 0
+	}
+
+	concurrency := p.concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	indexes := make(chan dispatch)
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+	var firstErr error
+	var wg sync.WaitGroup
+
+	targets := make([]string, len(svcs))
+	for t, svc := range svcs {
+		targets[t] = "s3"
+		if svc == p.boltSvc {
+			targets[t] = "bolt"
+		}
+	}
+
+	start := time.Now()
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for d := range indexes {
+				// delay of the op, from its scheduled start until the worker started it.
+				var delay time.Duration
+				if !d.intended.IsZero() {
+					delay = time.Since(d.intended)
+				}
+				for _, t := range d.order {
+					result, err := op(svcs[t], d.i)
+					if warmup {
+						continue
+					}
+					if !d.intended.IsZero() && !result.start.IsZero() {
+						// scheduled start of the request to the target, shifted by the requests before it.
+						result.intended = result.start.Add(-delay)
+					}
+					var exportErr error
+					if p.exporter != nil {
+						recordOperation := operation
+						if len(result.operation) > 0 {
+							recordOperation = result.operation
+						}
+						exportErr = p.exporter.write(p.requestRecord(recordOperation, targets[t], result, err))
+					}
+
+					// In error-tolerant mode, count the failed op and go on unless the error budget is exceeded.
+					failed := err != nil
+					if failed && p.errorBudget != nil {
+						results[t].recordError(result, err)
+						err = p.errorBudget.check(results[t], false)
+					}
+					if err == nil {
+						err = exportErr
+					}
+					if err != nil {
+						stopOnce.Do(func() {
+							firstErr = err
+							close(stop)
+						})
+						break
+					}
+					if !failed {
+						results[t].record(result)
+					}
+				}
+			}
+		}()
+	}
+
+	// In duration mode, dispatch indexes until the deadline, otherwise dispatch n indexes.
+	var deadline <-chan time.Time
+	if duration > 0 {
+		timer := time.NewTimer(duration)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	// If the run has a deadline, stop dispatching indexes at the deadline and fail the run.
+	var timeout *time.Timer
+	if !p.deadline.IsZero() {
+		timeout = time.AfterFunc(time.Until(p.deadline), func() {
+			stopOnce.Do(func() {
+				firstErr = ErrRunTimeout
+				close(stop)
+			})
+		})
+	}
+
+	order := newTargetOrder(p.ordering, len(svcs))
+
+dispatchLoop:
+	for i := 0; duration > 0 || i < n; i++ {
+		d := dispatch{i: i, order: order.next(i)}
+
+		// In target-rate mode, wait until the intended start of the op.
+		if rate > 0 {
+			d.intended = start.Add(time.Duration(float64(i) * float64(time.Second) / rate))
+			if wait := time.Until(d.intended); wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-timer.C:
+				case <-stop:
+					timer.Stop()
+					break dispatchLoop
+				case <-deadline:
+					timer.Stop()
+					break dispatchLoop
+				}
+			}
+		}
+
+		select {
+		case indexes <- d:
+		case <-stop:
+			break dispatchLoop
+		case <-deadline:
+			break dispatchLoop
+		}
+	}
+	close(indexes)
+	wg.Wait()
+	if timeout != nil {
+		// wait for the deadline callback, if it is running, before reading the first error.
+		timeout.Stop()
+		stopOnce.Do(func() {})
+	}
+	if firstErr == nil && p.errorBudget != nil && !warmup {
+		for _, targetResults := range results {
+			if firstErr = p.errorBudget.check(targetResults, true); firstErr != nil {
+				break
+			}
+		}
+	}
+
+	return results, time.Since(start), firstErr
+}
+
+// send sends the request of an operation started at result.start, and sets the time to first byte of the
+// operation and the HTTP status code of the response in the result. The phases of the request (DNS, connect,
+// TLS, write, first byte) are traced with httptrace.
+func send(req *request.Request, result *opResult) error {
+	result.trace = &requestTrace{}
+	req.SetContext(httptrace.WithClientTrace(req.Context(), result.trace.clientTrace()))
+	req.Handlers.Send.PushBack(func(r *request.Request) {
+		result.ttfb = time.Since(result.start)
+	})
+	err := req.Send()
+	result.retries = req.RetryCount
+	if req.HTTPResponse != nil {
+		result.status = req.HTTPResponse.StatusCode
+	}
+	return err
+}
+
+// requestRecord returns the record of the result of an operation, and of its error if it failed.
+func (p *BoltS3Perf) requestRecord(operation string, target string, result opResult, err error) *RequestRecord {
+	record := &RequestRecord{
+		Operation:   operation,
+		Target:      target,
+		Concurrency: p.concurrency,
+		Key:         result.key,
+		Size:        result.bytes,
+		Start:       result.start.UTC(),
+		LatencyMs:   durationMs(result.latency),
+		TTFBMs:      durationMs(result.ttfb),
+		Status:      result.status,
+		Retries:     result.retries,
+	}
+	if !result.intended.IsZero() {
+		intended := result.intended.UTC()
+		record.Intended = &intended
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	if result.trace != nil {
+		durations, occurred := result.trace.phases(result.start.Add(result.latency))
+		phaseMs := []**float64{&record.DNSMs, &record.ConnectMs, &record.TLSMs, &record.WriteMs,
+			&record.FirstByteMs, &record.TransferMs}
+		for i := range durations {
+			if occurred[i] {
+				ms := durationMs(durations[i])
+				*phaseMs[i] = &ms
+			}
+		}
+	}
+	return record
+}
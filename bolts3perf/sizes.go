@@ -0,0 +1,215 @@
+package bolts3perf
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// sizeUnits are the units of object sizes, e.g. "64KiB", "10MB".
+var sizeUnits = []struct {
+	suffix string
+	bytes int64
+}{
+	{"KIB", 1 << 10},
+	{"MIB", 1 << 20},
+	{"GIB", 1 << 30},
+	{"TIB", 1 << 40},
+	{"KB", 1000},
+	{"MB", 1000 * 1000},
+	{"GB", 1000 * 1000 * 1000},
+	{"TB", 1000 * 1000 * 1000 * 1000},
+	{"B", 1},
+}
+
+// maxObjectSize is the largest object size that can be uploaded to S3.
+const maxObjectSize = int64(5) << 40
+
+// sizeBucketBounds are the upper bounds (in bytes) of the object size buckets for which throughput is
+// reported. The last bucket counts the objects above the largest bound.
+var sizeBucketBounds = []int64{4 << 10, 64 << 10, 1 << 20, 16 << 20, 128 << 20, 1 << 30}
+
+// sizeDistribution chooses the size of the objects uploaded by a perf test, drawing from rng.
+type sizeDistribution interface {
+	next(rng *rand.Rand) int64
+	String() string
+}
+
+// fixedSize is a single object size.
+type fixedSize struct {
+	size int64
+}
+
+func (d *fixedSize) next(rng *rand.Rand) int64 {
+	return d.size
+}
+
+func (d *fixedSize) String() string {
+	return fmt.Sprintf("fixed:%d", d.size)
+}
+
+// uniformSize chooses object sizes uniformly in [min, max].
+type uniformSize struct {
+	min int64
+	max int64
+}
+
+func (d *uniformSize) next(rng *rand.Rand) int64 {
+	return d.min + rng.Int63n(d.max - d.min + 1)
+}
+
+func (d *uniformSize) String() string {
+	return fmt.Sprintf("uniform:%d:%d", d.min, d.max)
+}
+
+// lognormalSize chooses object sizes whose logarithm is normally distributed, with the given median and
+// standard deviation (sigma) of the logarithm.
+type lognormalSize struct {
+	median int64
+	sigma float64
+}
+
+func (d *lognormalSize) next(rng *rand.Rand) int64 {
+	size := math.Exp(math.Log(float64(d.median)) + d.sigma * rng.NormFloat64())
+	if size >= float64(maxObjectSize) {
+		return maxObjectSize
+	}
+	return int64(math.Round(size))
+}
+
+func (d *lognormalSize) String() string {
+	return fmt.Sprintf("lognormal:%d:%g", d.median, d.sigma)
+}
+
+// weightedSizes chooses among a list of object sizes, each with a probability proportional to its weight.
+type weightedSizes struct {
+	sizes []int64
+	// cumulative weights of the sizes.
+	cumWeights []float64
+}
+
+func (d *weightedSizes) next(rng *rand.Rand) int64 {
+	r := rng.Float64() * d.cumWeights[len(d.cumWeights) - 1]
+	return d.sizes[sort.SearchFloat64s(d.cumWeights, r)]
+}
+
+func (d *weightedSizes) String() string {
+	sizes := make([]string, len(d.sizes))
+	prev := 0.0
+	for i, size := range d.sizes {
+		sizes[i] = fmt.Sprintf("%d=%g", size, d.cumWeights[i] - prev)
+		prev = d.cumWeights[i]
+	}
+	return strings.Join(sizes, ",")
+}
+
+// parseSizeDistribution parses a size distribution:
+// 1) fixed:<size> - a single size
+// 2) uniform:<min>:<max> - sizes uniformly distributed between min and max
+// 3) lognormal:<median>:<sigma> - log-normally distributed sizes, with the median size and the standard
+//    deviation of the logarithm of the sizes
+// 4) <size>=<weight>,<size>=<weight>,... - a list of sizes with weights
+// If no distribution is passed, objects of defaultSize bytes are uploaded.
+func parseSizeDistribution(s string, defaultSize int64) (sizeDistribution, error) {
+
+	if len(s) == 0 {
+		return &fixedSize{size: defaultSize}, nil
+	}
+
+	parts := strings.Split(s, ":")
+	switch strings.ToUpper(strings.TrimSpace(parts[0])) {
+	case "FIXED":
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid sizeDistribution: %s", s)
+		}
+		size, err := parseSize(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		return &fixedSize{size: size}, nil
+	case "UNIFORM":
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("invalid sizeDistribution: %s", s)
+		}
+		min, err := parseSize(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		max, err := parseSize(parts[2])
+		if err != nil {
+			return nil, err
+		}
+		if max < min {
+			return nil, fmt.Errorf("invalid sizeDistribution: %s", s)
+		}
+		return &uniformSize{min: min, max: max}, nil
+	case "LOGNORMAL":
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("invalid sizeDistribution: %s", s)
+		}
+		median, err := parseSize(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		sigma, err := strconv.ParseFloat(strings.TrimSpace(parts[2]), 64)
+		if err != nil || !(sigma >= 0) || math.IsInf(sigma, 1) || median == 0 {
+			return nil, fmt.Errorf("invalid sizeDistribution: %s", s)
+		}
+		return &lognormalSize{median: median, sigma: sigma}, nil
+	}
+
+	d := &weightedSizes{}
+	var total float64 = 0
+	for _, entry := range strings.Split(s, ",") {
+		sizeWeight := strings.SplitN(entry, "=", 2)
+		if len(sizeWeight) != 2 {
+			return nil, fmt.Errorf("invalid sizeDistribution: %s", s)
+		}
+		size, err := parseSize(sizeWeight[0])
+		if err != nil {
+			return nil, err
+		}
+		weight, err := strconv.ParseFloat(strings.TrimSpace(sizeWeight[1]), 64)
+		if err != nil || !(weight >= 0) || math.IsInf(weight, 1) {
+			return nil, fmt.Errorf("invalid size weight: %s", entry)
+		}
+		if weight == 0 {
+			continue
+		}
+		total += weight
+		d.sizes = append(d.sizes, size)
+		d.cumWeights = append(d.cumWeights, total)
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("invalid sizeDistribution: %s", s)
+	}
+	return d, nil
+}
+
+// parseSize parses an object size: a no. of bytes, optionally followed by a unit (B, KB, MB, GB, TB or KiB,
+// MiB, GiB, TiB), e.g. "64KiB", "1.5MB".
+func parseSize(s string) (int64, error) {
+
+	value := strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			multiplier = unit.bytes
+			break
+		}
+	}
+
+	// NaN is not a valid size, and sizes above maxObjectSize (including +Inf) are checked before the conversion.
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || !(n >= 0) {
+		return 0, fmt.Errorf("invalid size: %s", s)
+	}
+	if math.Round(n * float64(multiplier)) > float64(maxObjectSize) {
+		return 0, fmt.Errorf("invalid size: %s (larger than 5 TiB)", s)
+	}
+	return int64(math.Round(n * float64(multiplier))), nil
+}
@@ -0,0 +1,180 @@
+package bolts3perf
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		s string
+		want int64
+		wantErr bool
+	}{
+		{s: "0", want: 0},
+		{s: "1024", want: 1024},
+		{s: "1.5", want: 2},
+		{s: "100B", want: 100},
+		{s: "64KiB", want: 64 << 10},
+		{s: "64kib", want: 64 << 10},
+		{s: "0.5KB", want: 500},
+		{s: "1.5MB", want: 1500000},
+		{s: " 10 MB ", want: 10000000},
+		{s: "8MiB", want: 8 << 20},
+		{s: "1GB", want: 1000000000},
+		{s: "1GiB", want: 1 << 30},
+		{s: "2TB", want: 2000000000000},
+		{s: "5TiB", want: maxObjectSize},
+		{s: "6TiB", wantErr: true},
+		{s: "5497558138881", wantErr: true},
+		{s: "", wantErr: true},
+		{s: "KB", wantErr: true},
+		{s: "abc", wantErr: true},
+		{s: "-1", wantErr: true},
+		{s: "-1KB", wantErr: true},
+		{s: "10XB", wantErr: true},
+		{s: "1KB2", wantErr: true},
+		{s: "NaN", wantErr: true},
+		{s: "Inf", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := parseSize(tt.s)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseSize(%q) = %d, want an error", tt.s, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseSize(%q) error = %v", tt.s, err)
+			}
+			if got != tt.want {
+				t.Errorf("parseSize(%q) = %d, want %d", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSizeDistribution(t *testing.T) {
+	tests := []struct {
+		s string
+		want sizeDistribution
+		wantErr bool
+	}{
+		{s: "", want: &fixedSize{size: 1024}},
+		{s: "fixed:1MiB", want: &fixedSize{size: 1 << 20}},
+		{s: "FIXED: 100", want: &fixedSize{size: 100}},
+		{s: "uniform:1KB:10MB", want: &uniformSize{min: 1000, max: 10000000}},
+		{s: "uniform:1KiB:1KiB", want: &uniformSize{min: 1 << 10, max: 1 << 10}},
+		{s: "lognormal:1MiB:0.5", want: &lognormalSize{median: 1 << 20, sigma: 0.5}},
+		{s: "lognormal:1MiB:0", want: &lognormalSize{median: 1 << 20, sigma: 0}},
+		{
+			s:    "4KiB=50,1MiB=40,200MiB=10",
+			want: &weightedSizes{sizes: []int64{4 << 10, 1 << 20, 200 << 20}, cumWeights: []float64{50, 90, 100}},
+		},
+		{s: "100=1,200=0,300=2", want: &weightedSizes{sizes: []int64{100, 300}, cumWeights: []float64{1, 3}}},
+		{s: "100=0.5", want: &weightedSizes{sizes: []int64{100}, cumWeights: []float64{0.5}}},
+		{s: "fixed", wantErr: true},
+		{s: "fixed:1:2", wantErr: true},
+		{s: "fixed:abc", wantErr: true},
+		{s: "fixed:6TiB", wantErr: true},
+		{s: "uniform:1KB", wantErr: true},
+		{s: "uniform:10MB:1KB", wantErr: true},
+		{s: "uniform:1KB:x", wantErr: true},
+		{s: "lognormal:1MiB", wantErr: true},
+		{s: "lognormal:0:1", wantErr: true},
+		{s: "lognormal:1MiB:-1", wantErr: true},
+		{s: "lognormal:1MiB:x", wantErr: true},
+		{s: "lognormal:1MiB:NaN", wantErr: true},
+		{s: "normal:1KB:1MB", wantErr: true},
+		{s: "1KB", wantErr: true},
+		{s: "1KB=", wantErr: true},
+		{s: "1KB=x", wantErr: true},
+		{s: "1KB=-1", wantErr: true},
+		{s: "1KB=NaN", wantErr: true},
+		{s: "1KB=Inf", wantErr: true},
+		{s: "1KB=0,2KB=0", wantErr: true},
+		{s: "1KB=1,", wantErr: true},
+		{s: "x=1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := parseSizeDistribution(tt.s, 1024)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseSizeDistribution(%q) = %v, want an error", tt.s, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseSizeDistribution(%q) error = %v", tt.s, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseSizeDistribution(%q) = %#v, want %#v", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSizeDistributionNext(t *testing.T) {
+	tests := []struct {
+		s string
+		min int64
+		max int64
+		// the only sizes that can be chosen, if any.
+		sizes []int64
+	}{
+		{s: "fixed:1MiB", min: 1 << 20, max: 1 << 20},
+		{s: "uniform:1KB:10KB", min: 1000, max: 10000},
+		{s: "lognormal:1MiB:3", min: 0, max: maxObjectSize},
+		{s: "4KiB=50,1MiB=40,200MiB=10", min: 4 << 10, max: 200 << 20, sizes: []int64{4 << 10, 1 << 20, 200 << 20}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			d, err := parseSizeDistribution(tt.s, 0)
+			if err != nil {
+				t.Fatalf("parseSizeDistribution(%q) error = %v", tt.s, err)
+			}
+			rng := rand.New(rand.NewSource(1))
+			chosen := make(map[int64]bool)
+			for i := 0; i < 1000; i++ {
+				size := d.next(rng)
+				if size < tt.min || size > tt.max {
+					t.Fatalf("next() = %d, want in [%d, %d]", size, tt.min, tt.max)
+				}
+				chosen[size] = true
+			}
+			for size := range chosen {
+				if tt.sizes != nil && !containsSize(tt.sizes, size) {
+					t.Errorf("next() = %d, want one of %v", size, tt.sizes)
+				}
+			}
+			if tt.sizes != nil && len(chosen) != len(tt.sizes) {
+				t.Errorf("%d sizes chosen, want %d", len(chosen), len(tt.sizes))
+			}
+
+			// the sizes only depend on the generator.
+			rng1, rng2 := rand.New(rand.NewSource(2)), rand.New(rand.NewSource(2))
+			for i := 0; i < 10; i++ {
+				if a, b := d.next(rng1), d.next(rng2); a != b {
+					t.Fatalf("next() = %d and %d with the same seed", a, b)
+				}
+			}
+		})
+	}
+}
+
+// containsSize returns whether the size is one of the sizes.
+func containsSize(sizes []int64, size int64) bool {
+	for _, s := range sizes {
+		if s == size {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package bolts3perf
+
+import (
+	"sort"
+	"time"
+)
+
+// latencyBucketBounds are the upper bounds (in ms) of the latency histogram buckets. The last bucket
+// counts the samples above the largest bound.
+var latencyBucketBounds = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// HistogramBucket is the no. of samples that are at most UpperBound (and above the previous bucket's bound),
+// e.g. "2.5 ms". The UpperBound of the last bucket is "+Inf".
+type HistogramBucket struct {
+	UpperBound string `json:"le"`
+	Count int `json:"count"`
+}
+
+// summary holds the summary statistics of a set of samples.
+type summary struct {
+	count int
+	min float64
+	max float64
+	mean float64
+	stdDev float64
+	p50 float64
+	p90 float64
+	p95 float64
+	p99 float64
+	p999 float64
+}
+
+// histogramSummary computes the summary statistics of the values recorded in the histogram, dividing each
+// value by scale (e.g. 1e6 to convert ns to ms). Percentiles are interpolated linearly between the values of
+// adjacent ranks (see InterpolatedValueAtPercentile), each value being the middle value of its bucket.
+func histogramSummary(h *Histogram, scale float64) summary {
+
+	s := summary{count: int(h.TotalCount())}
+	if s.count == 0 {
+		return s
+	}
+
+	s.min = float64(h.Min()) / scale
+	s.max = float64(h.Max()) / scale
+	s.mean = h.Mean() / scale
+	s.stdDev = h.StdDev() / scale
+	s.p50 = h.InterpolatedValueAtPercentile(50) / scale
+	s.p90 = h.InterpolatedValueAtPercentile(90) / scale
+	s.p95 = h.InterpolatedValueAtPercentile(95) / scale
+	s.p99 = h.InterpolatedValueAtPercentile(99) / scale
+	s.p999 = h.InterpolatedValueAtPercentile(99.9) / scale
+	return s
+}
+
+// histogramBuckets counts the values recorded in the histogram, divided by scale, in buckets with the given
+// upper bounds, plus a last bucket for values above the largest bound.
+func histogramBuckets(h *Histogram, scale float64, bounds []float64) []NumericHistogramBucket {
+	buckets := make([]NumericHistogramBucket, len(bounds) + 1)
+	for i := range bounds {
+		buckets[i].UpperBound = &bounds[i]
+	}
+
+	h.forEachValue(func(value int64, count int64) {
+		b := sort.SearchFloat64s(bounds, float64(value) / scale)
+		buckets[b].Count += int(count)
+	})
+	return buckets
+}
+
+// numericPerfStat returns the summary statistics, in the given unit.
+func (s summary) numericPerfStat(unit string) *NumericPerfStat {
+	return &NumericPerfStat{
+		Unit:    unit,
+		Count:   s.count,
+		Min:     s.min,
+		Max:     s.max,
+		Average: s.mean,
+		StdDev:  s.stdDev,
+		P50:     s.p50,
+		P90:     s.p90,
+		P95:     s.p95,
+		P99:     s.p99,
+		P999:    s.p999,
+	}
+}
+
+// phaseStats returns the latency stats (ms) of the phases of the recorded requests, or nil if no request was
+// traced.
+func phaseStats(results *recorder) *NumericPhaseStats {
+	var stats [numPhases]*NumericPerfStat
+	traced := false
+	for i, h := range results.phases {
+		if h.TotalCount() > 0 {
+			stats[i] = histogramSummary(h, float64(time.Millisecond)).numericPerfStat("ms")
+			traced = true
+		}
+	}
+	if !traced {
+		return nil
+	}
+	return &NumericPhaseStats{
+		DNS:       stats[phaseDNS],
+		Connect:   stats[phaseConnect],
+		TLS:       stats[phaseTLS],
+		Write:     stats[phaseWrite],
+		FirstByte: stats[phaseFirstByte],
+		Transfer:  stats[phaseTransfer],
+	}
+}
@@ -0,0 +1,90 @@
+package bolts3perf
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Phases of a request, measured with httptrace.
+const (
+	// DNS lookup, if the request opened a new connection.
+	phaseDNS = iota
+	// TCP connection, if the request opened a new connection.
+	phaseConnect
+	// TLS handshake, if the request opened a new connection.
+	phaseTLS
+	// from getting a connection to writing the request (headers and body).
+	phaseWrite
+	// from writing the request to receiving the first byte of the response.
+	phaseFirstByte
+	// from receiving the first byte of the response to the end of the operation, including the body transfer.
+	phaseTransfer
+	numPhases
+)
+
+// requestTrace records the times of the events of the last attempt of a request.
+type requestTrace struct {
+	mu sync.Mutex
+	dnsStart time.Time
+	dnsDone time.Time
+	connectStart time.Time
+	connectDone time.Time
+	tlsStart time.Time
+	tlsDone time.Time
+	gotConn time.Time
+	wroteRequest time.Time
+	firstByte time.Time
+}
+
+// clientTrace returns the httptrace hooks that record the events of the request. The events of an attempt are
+// reset when the attempt gets a connection, so that only the last attempt of a retried request is recorded.
+func (t *requestTrace) clientTrace() *httptrace.ClientTrace {
+	set := func(field *time.Time) {
+		t.mu.Lock()
+		*field = time.Now()
+		t.mu.Unlock()
+	}
+	return &httptrace.ClientTrace{
+		GetConn: func(hostPort string) {
+			t.mu.Lock()
+			t.dnsStart, t.dnsDone = time.Time{}, time.Time{}
+			t.connectStart, t.connectDone = time.Time{}, time.Time{}
+			t.tlsStart, t.tlsDone = time.Time{}, time.Time{}
+			t.gotConn, t.wroteRequest, t.firstByte = time.Time{}, time.Time{}, time.Time{}
+			t.mu.Unlock()
+		},
+		DNSStart:             func(httptrace.DNSStartInfo) { set(&t.dnsStart) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { set(&t.dnsDone) },
+		ConnectStart:         func(string, string) { set(&t.connectStart) },
+		ConnectDone:          func(string, string, error) { set(&t.connectDone) },
+		TLSHandshakeStart:    func() { set(&t.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { set(&t.tlsDone) },
+		GotConn:              func(httptrace.GotConnInfo) { set(&t.gotConn) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { set(&t.wroteRequest) },
+		GotFirstResponseByte: func() { set(&t.firstByte) },
+	}
+}
+
+// phases returns the duration of each phase of the request that ended at end, and whether the phase occurred.
+func (t *requestTrace) phases(end time.Time) ([numPhases]time.Duration, [numPhases]bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var durations [numPhases]time.Duration
+	var occurred [numPhases]bool
+	phase := func(p int, start time.Time, done time.Time) {
+		if !start.IsZero() && !done.IsZero() && !done.Before(start) {
+			durations[p] = done.Sub(start)
+			occurred[p] = true
+		}
+	}
+	phase(phaseDNS, t.dnsStart, t.dnsDone)
+	phase(phaseConnect, t.connectStart, t.connectDone)
+	phase(phaseTLS, t.tlsStart, t.tlsDone)
+	phase(phaseWrite, t.gotConn, t.wroteRequest)
+	phase(phaseFirstByte, t.wroteRequest, t.firstByte)
+	phase(phaseTransfer, t.firstByte, end)
+	return durations, occurred
+}
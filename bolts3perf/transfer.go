@@ -0,0 +1,212 @@
+package bolts3perf
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// partLatencies collects the latencies of the parts of a multipart upload or parallel download, and the no. of
+// times their requests were retried.
+type partLatencies struct {
+	mu sync.Mutex
+	latencies []time.Duration
+	retries int
+}
+
+func (l *partLatencies) add(latency time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.latencies = append(l.latencies, latency)
+}
+
+func (l *partLatencies) get() []time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.latencies
+}
+
+func (l *partLatencies) addRetries(retries int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.retries += retries
+}
+
+func (l *partLatencies) retryCount() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.retries
+}
+
+// newUploader returns an uploader that uploads parts of partSize bytes, partConcurrency parts at a time, with
+// the given Bolt / S3 client, and adds the latency of each successful part (upload part request) and the retries
+// of each request to parts.
+func (p *BoltS3Perf) newUploader(svc *s3.S3, parts *partLatencies) *s3manager.Uploader {
+	return s3manager.NewUploaderWithClient(svc, func(u *s3manager.Uploader) {
+		u.PartSize = p.partSize
+		u.Concurrency = p.partConcurrency
+		u.RequestOptions = append(u.RequestOptions, func(r *request.Request) {
+			r.Handlers.Complete.PushBack(func(r *request.Request) {
+				parts.addRetries(r.RetryCount)
+				if r.Operation.Name == "UploadPart" && r.Error == nil {
+					parts.add(time.Since(r.AttemptTime))
+				}
+			})
+		})
+	})
+}
+
+// putObjectMultipartPerf measures the multipart upload performance (throughput, latency of the uploads and of
+// their parts) of Bolt / S3.
+func (p *BoltS3Perf) putObjectMultipartPerf(bucket string) (map[string]interface{}, error) {
+
+	// Upload an object for each key, numIter times, to S3 and Bolt, with the same size and data for both.
+	seed := time.Now().UnixNano()
+	runs, err := p.runTargets("put_object_multipart", p.targets(), p.numOps(), p.warmup, func(svc *s3.S3,
+		i int) (opResult, error) {
+		rng := opRand(seed, i)
+		return p.putObject(svc, bucket, p.keys[i % len(p.keys)], p.sizes.next(rng), rng.Int63())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	putObjMultipartPerfRespMap := make(map[string]interface{})
+	putObjMultipartPerfRespMap["s3_put_obj_multipart_perf_stats"] = p.output(p.runStats(runs[0], false, true))
+	putObjMultipartPerfRespMap["bolt_put_obj_multipart_perf_stats"] = p.output(p.runStats(runs[1], false, true))
+	putObjMultipartPerfRespMap["put_obj_multipart_comparison"] = p.outputComparison(compareRuns(runs[0], runs[1]))
+	return putObjMultipartPerfRespMap, nil
+}
+
+// getObjectParallelPerf measures the parallel ranged download performance (throughput, latency of the
+// downloads and of their parts) of Bolt / S3.
+func (p *BoltS3Perf) getObjectParallelPerf(bucket string) (map[string]interface{}, error) {
+
+	// Download the object of each key, numIter times, from S3 and Bolt in parallel ranges.
+	runs, err := p.runTargets("get_object_parallel", p.targets(), p.numOps(), p.warmup, func(svc *s3.S3,
+		i int) (opResult, error) {
+		return p.getObjectParallel(svc, bucket, p.keys[i % len(p.keys)])
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	getObjParallelPerfRespMap := make(map[string]interface{})
+	getObjParallelPerfRespMap["s3_get_obj_parallel_perf_stats"] = p.output(p.runStats(runs[0], false, true))
+	getObjParallelPerfRespMap["bolt_get_obj_parallel_perf_stats"] = p.output(p.runStats(runs[1], false, true))
+	getObjParallelPerfRespMap["get_obj_parallel_comparison"] = p.outputComparison(compareRuns(runs[0], runs[1]))
+	return getObjParallelPerfRespMap, nil
+}
+
+// getObjectParallel downloads the object in ranges of partSize bytes, partConcurrency ranges at a time, as the
+// s3manager downloader does: the first range also returns the size of the object, and the other ranges are
+// then downloaded in parallel. The latency of each range includes reading its body.
+func (p *BoltS3Perf) getObjectParallel(svc *s3.S3, bucket string, key string) (opResult, error) {
+
+	result := opResult{key: key, start: time.Now()}
+	parts := &partLatencies{}
+
+	// download the first range, and get the size of the object.
+	n, size, err := p.getPart(svc, bucket, key, 0, parts)
+	if err != nil {
+		result.latency = time.Since(result.start)
+		result.retries = parts.retryCount()
+		return result, err
+	}
+	total := n
+
+	// download the other ranges in parallel. No more ranges are dispatched once a range has failed.
+	offsets := make(chan int64)
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+	var mu sync.Mutex
+	var firstErr error
+	var wg sync.WaitGroup
+	for w := 0; w < p.partConcurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for offset := range offsets {
+				n, _, err := p.getPart(svc, bucket, key, offset, parts)
+				mu.Lock()
+				total += n
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+				if err != nil {
+					stopOnce.Do(func() { close(stop) })
+				}
+			}
+		}()
+	}
+dispatchLoop:
+	for offset := p.partSize; offset < size; offset += p.partSize {
+		select {
+		case offsets <- offset:
+		case <-stop:
+			break dispatchLoop
+		}
+	}
+	close(offsets)
+	wg.Wait()
+
+	// calc latency
+	result.latency = time.Since(result.start)
+	result.bytes = total
+	result.parts = parts.get()
+	result.retries = parts.retryCount()
+	if firstErr != nil {
+		return result, firstErr
+	}
+	result.status = http.StatusOK
+	return result, nil
+}
+
+// getPart downloads the range of partSize bytes at the offset of the object, reading its body, and adds its
+// latency and retries to parts. It returns the no. of bytes read and the size of the object.
+func (p *BoltS3Perf) getPart(svc *s3.S3, bucket string, key string, offset int64,
+	parts *partLatencies) (int64, int64, error) {
+
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key: aws.String(key),
+		Range: aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset + p.partSize - 1)),
+	}
+	// a range of an empty object is not satisfiable, so empty objects are downloaded without a range.
+	if size, ok := p.objectSizes.get(key); ok && size == 0 {
+		input.Range = nil
+	}
+
+	start := time.Now()
+	req, output := svc.GetObjectRequest(input)
+	err := req.Send()
+	parts.addRetries(req.RetryCount)
+	if err != nil {
+		return 0, 0, err
+	}
+	n, err := io.Copy(ioutil.Discard, output.Body)
+	output.Body.Close()
+	if err != nil {
+		return n, 0, err
+	}
+	parts.add(time.Since(start))
+
+	// the size of the object follows the range in Content-Range, e.g. "bytes 0-8388607/1073741824".
+	size := aws.Int64Value(output.ContentLength)
+	if contentRange := aws.StringValue(output.ContentRange); strings.Contains(contentRange, "/") {
+		if total, err := strconv.ParseInt(contentRange[strings.LastIndex(contentRange, "/") + 1:], 10, 64); err == nil {
+			size = total
+		}
+	}
+	return n, size, nil
+}
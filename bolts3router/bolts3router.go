@@ -0,0 +1,112 @@
+package bolts3router
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gitlab.com/projectn-oss/projectn-bolt-go-sample/bolts3opsclient"
+	"gitlab.com/projectn-oss/projectn-bolt-go-sample/bolts3perf"
+	"strings"
+)
+
+// ErrUnsupportedHandler is returned when the 'handler' (or 'mode') field of an event does not name a supported handler.
+var ErrUnsupportedHandler = errors.New("unsupported handler")
+
+// RouterEvent holds the top-level fields used to select the handler logic that processes an event.
+// The remaining fields of the event are passed through unchanged to the selected handler.
+type RouterEvent struct {
+	Handler string `json:"handler"`
+	Mode string `json:"mode"`
+}
+
+// Route extracts the 'handler' (or 'mode') field from the raw event, decodes the event into the input type
+// expected by the selected handler logic and dispatches it. The following handlers are supported:
+// 1) ops (BoltS3OpsHandler) - S3 API operations with Bolt and S3 (default handler if none specified)
+// 2) perf (BoltS3PerfHandler) - Bolt / S3 Performance tests
+// 3) validate (BoltS3ValidateObjHandler) - Data validation tests
+// 4) autoheal (BoltAutoHealHandler) - Auto heal tests
+// Perf tests are stopped before the deadline of ctx (the Lambda context), leaving time for their cleanup.
+func Route(ctx context.Context, payload json.RawMessage) (map[string]interface{}, error) {
+
+	var routerEvent RouterEvent
+	if err := json.Unmarshal(payload, &routerEvent); err != nil {
+		return nil, err
+	}
+
+	handler := routerEvent.handler()
+	switch normalizeHandler(handler) {
+	case "OPS":
+		var event bolts3opsclient.BoltEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return nil, err
+		}
+		boltS3OpsClient := bolts3opsclient.BoltS3OpsClient{}
+		return boltS3OpsClient.ProcessEvent(&event)
+	case "PERF":
+		var event bolts3perf.PerfEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return nil, err
+		}
+		boltS3Perf := bolts3perf.BoltS3Perf{}
+		return boltS3Perf.ProcessEventWithContext(ctx, &event)
+	case "VALIDATE":
+		var event bolts3opsclient.BoltEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return nil, err
+		}
+		return bolts3opsclient.ValidateObj(&event)
+	case "AUTOHEAL":
+		var event bolts3opsclient.BoltEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return nil, err
+		}
+		return bolts3opsclient.AutoHeal(&event)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedHandler, handler)
+	}
+}
+
+// CheckOpsEvent returns an error wrapping bolts3opsclient.ErrUnsupportedRequestType if the raw event is routed to
+// the ops handler but its 'requestType' field does not name a supported request, so that callers can reject the
+// event instead of acknowledging the empty response of the ops handler.
+func CheckOpsEvent(payload json.RawMessage) error {
+
+	var routerEvent RouterEvent
+	if err := json.Unmarshal(payload, &routerEvent); err != nil {
+		return err
+	}
+	if normalizeHandler(routerEvent.handler()) != "OPS" {
+		return nil
+	}
+
+	var event bolts3opsclient.BoltEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return err
+	}
+	return bolts3opsclient.CheckRequestType(event.RequestType)
+}
+
+// handler returns the handler selected by the event. 'handler' takes precedence over 'mode' if both are passed.
+func (e *RouterEvent) handler() string {
+	if len(e.Handler) > 0 {
+		return e.Handler
+	}
+	return e.Mode
+}
+
+// normalizeHandler maps the short handler names and the Lambda handler (binary) names onto one canonical name.
+func normalizeHandler(handler string) string {
+	switch strings.ToUpper(handler) {
+	case "", "OPS", "BOLTS3OPSHANDLER":
+		return "OPS"
+	case "PERF", "BOLTS3PERFHANDLER":
+		return "PERF"
+	case "VALIDATE", "VALIDATE_OBJ", "BOLTS3VALIDATEOBJHANDLER":
+		return "VALIDATE"
+	case "AUTOHEAL", "AUTO_HEAL", "BOLTAUTOHEALHANDLER":
+		return "AUTOHEAL"
+	default:
+		return strings.ToUpper(handler)
+	}
+}
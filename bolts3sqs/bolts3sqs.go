@@ -0,0 +1,89 @@
+package bolts3sqs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"gitlab.com/projectn-oss/projectn-bolt-go-sample/bolts3router"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// defaultConcurrency is the no. of messages processed concurrently if 'SQS_CONCURRENCY' is not configured.
+const defaultConcurrency = 10
+
+// SQSEventResponse reports the messages of a batch that failed to be processed, so that only those messages
+// are returned to the queue. The event source mapping must have 'ReportBatchItemFailures' enabled.
+type SQSEventResponse struct {
+	BatchItemFailures []SQSBatchItemFailure `json:"batchItemFailures"`
+}
+
+// SQSBatchItemFailure identifies a message that failed to be processed.
+type SQSBatchItemFailure struct {
+	ItemIdentifier string `json:"itemIdentifier"`
+}
+
+// ProcessEvent processes the messages of an SQS batch, with up to 'SQS_CONCURRENCY' messages in flight.
+// The body of each message is an event that is dispatched to the Ops, Perf, Data Validation or Auto Heal logic
+// by its 'handler' (or 'mode') field. A message fails if its event cannot be processed, or if it is a data
+// validation job whose Bolt and S3 MD5 hashes do not match. ctx is the Lambda context of the batch.
+func ProcessEvent(ctx context.Context, event *events.SQSEvent) SQSEventResponse {
+
+	concurrency := defaultConcurrency
+	if v, err := strconv.Atoi(os.Getenv("SQS_CONCURRENCY")); err == nil && v > 0 {
+		concurrency = v
+	}
+
+	failed := make([]bool, len(event.Records))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i := range event.Records {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			message := &event.Records[i]
+			if err := processMessage(ctx, message); err != nil {
+				log.Printf("failed to process message: messageId=%s error=%v", message.MessageId, err)
+				failed[i] = true
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	resp := SQSEventResponse{BatchItemFailures: []SQSBatchItemFailure{}}
+	for i, message := range event.Records {
+		if failed[i] {
+			resp.BatchItemFailures = append(resp.BatchItemFailures, SQSBatchItemFailure{ItemIdentifier: message.MessageId})
+		}
+	}
+	return resp
+}
+
+// processMessage dispatches the event in the message body to the selected handler logic.
+// Ops events with an unsupported 'requestType' fail instead of being acknowledged with an empty response.
+func processMessage(ctx context.Context, message *events.SQSMessage) error {
+
+	if err := bolts3router.CheckOpsEvent(json.RawMessage(message.Body)); err != nil {
+		return err
+	}
+
+	respMap, err := bolts3router.Route(ctx, json.RawMessage(message.Body))
+	if err != nil {
+		return err
+	}
+
+	// A data validation job fails if the Bolt and S3 MD5 hashes do not match.
+	s3Md5, _ := respMap["s3-md5"].(string)
+	boltMd5, _ := respMap["bolt-md5"].(string)
+	if len(s3Md5) > 0 && s3Md5 != boltMd5 {
+		return fmt.Errorf("data validation mismatch: s3-md5=%s bolt-md5=%s", s3Md5, boltMd5)
+	}
+	return nil
+}